@@ -0,0 +1,286 @@
+// Command flb-replay writes Fluent Bit msgpack chunks through the syslog
+// output plugin's sinks without running Fluent Bit, for load and regression
+// testing.
+//
+// The chunks are read from the files given as arguments, either chunk files
+// of the filesystem storage of Fluent Bit or plain msgpack records as
+// Fluent Bit passes them to output plugins. Without files, records like the
+// ones of the kubernetes filter are generated. Sinks are configured as with
+// syslog-send, and the records are written at the given rate.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/config"
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+type chunk struct {
+	tag     string
+	records []timedRecord
+}
+
+type timedRecord struct {
+	ts     time.Time
+	record map[interface{}]interface{}
+}
+
+type instance struct {
+	sink    *syslog.Sink
+	out     *syslog.Out
+	cluster bool
+	written int64
+}
+
+func main() {
+	var sections config.Sections
+	sections.RegisterFlags(flag.CommandLine)
+	synthetic := flag.Int("synthetic", 1000, "number of records to generate without chunk files")
+	pods := flag.Int("pods", 10, "number of pods the generated records are spread across")
+	namespaces := flag.String("namespaces", "", "comma separated namespaces of the generated records (default those of the sinks)")
+	messageSize := flag.Int("message-size", 100, "size of the log message of generated records")
+	tag := flag.String("tag", "", "tag of the records (default the tag of the chunk file or pod.log)")
+	rate := flag.Float64("rate", 0, "records written per second, 0 for as fast as possible")
+	loops := flag.Int("loop", 1, "number of times the records are written")
+	timeout := flag.Duration("timeout", 30*time.Second, "how long to wait for the messages to be sent")
+	flag.Parse()
+
+	if len(sections) == 0 {
+		fmt.Fprintln(os.Stderr, "flb-replay: no sink configured, use -o Addr=host:port")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var instances []*instance
+	var sinkNamespaces []string
+	for i, keys := range sections {
+		if keys["instancename"] == "" {
+			keys["instancename"] = fmt.Sprintf("sink-%d", i+1)
+		}
+		cfg, err := config.Parse(func(key string) string {
+			return keys[key]
+		})
+		if err != nil {
+			fatalf("sink %s: invalid configuration: %s", keys["instancename"], err)
+		}
+		var sinks, clusterSinks []*syslog.Sink
+		if cfg.Cluster {
+			clusterSinks = []*syslog.Sink{cfg.Sink}
+		} else {
+			sinks = []*syslog.Sink{cfg.Sink}
+			sinkNamespaces = append(sinkNamespaces, cfg.Sink.Namespace)
+		}
+		instances = append(instances, &instance{
+			sink:    cfg.Sink,
+			out:     syslog.NewOut(sinks, clusterSinks, cfg.Options...),
+			cluster: cfg.Cluster,
+		})
+	}
+
+	var chunks []chunk
+	if flag.NArg() == 0 {
+		ns := sinkNamespaces
+		if *namespaces != "" {
+			ns = strings.Split(*namespaces, ",")
+		}
+		if len(ns) == 0 {
+			ns = []string{"default"}
+		}
+		c, err := generate(*synthetic, *pods, ns, *messageSize)
+		if err != nil {
+			fatalf("unable to generate records: %s", err)
+		}
+		chunks = append(chunks, c)
+	}
+	for _, path := range flag.Args() {
+		c, err := readChunkFile(path)
+		if err != nil {
+			fatalf("unable to read %s: %s", path, err)
+		}
+		chunks = append(chunks, c)
+	}
+
+	var total int
+	start := time.Now()
+	for l := 0; l < *loops; l++ {
+		for _, c := range chunks {
+			t := *tag
+			if t == "" {
+				t = c.tag
+			}
+			if t == "" {
+				t = "pod.log"
+			}
+			for _, r := range c.records {
+				if *rate > 0 {
+					due := start.Add(time.Duration(float64(total) / *rate * float64(time.Second)))
+					time.Sleep(time.Until(due))
+				}
+				ns := namespace(r.record)
+				for _, inst := range instances {
+					inst.out.Write(r.record, r.ts, t)
+					if inst.cluster || ns == inst.sink.Namespace {
+						inst.written++
+					}
+				}
+				total++
+			}
+		}
+	}
+	for _, inst := range instances {
+		inst.out.Flush(*timeout)
+	}
+	elapsed := time.Since(start)
+	fmt.Printf("wrote %d records in %s (%.0f records/s)\n", total, elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds())
+
+	failed := false
+	deadline := time.Now().Add(*timeout)
+	for _, inst := range instances {
+		if !report(inst, deadline) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// report waits for the records routed to the sink of an instance to be sent
+// and prints its counters. It reports whether all messages were sent.
+func report(inst *instance, deadline time.Time) bool {
+	s := inst.sink
+	want := inst.written
+	for time.Now().Before(deadline) {
+		if s.MessagesSent()+s.MessagesDropped()+s.MessagesSuppressed() >= want {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	sent := s.MessagesSent()
+	stats := inst.out.MetadataCacheStats()
+	fmt.Printf("sink %s: sent %d of %d, dropped %d, suppressed %d, oversized %d, retried %d, metadata cache hit rate %.1f%%\n",
+		s.Name,
+		sent,
+		want,
+		s.MessagesDropped(),
+		s.MessagesSuppressed(),
+		s.MessagesOversized(),
+		s.MessagesRetried(),
+		100*stats.HitRate(),
+	)
+	if err := s.LoadSinkError(); err != nil {
+		fmt.Printf("  last error at %s: %s\n", err.Timestamp.Format(time.RFC3339), err.Msg)
+	}
+	return sent >= want
+}
+
+// namespace returns the namespace the kubernetes filter added to a record.
+func namespace(record map[interface{}]interface{}) string {
+	k8s, _ := record["kubernetes"].(map[interface{}]interface{})
+	ns, _ := k8s["namespace_name"].([]byte)
+	return string(ns)
+}
+
+// Chunk files of the filesystem storage start with the 0xC1 0x00 magic
+// bytes, a CRC32 of the content and padding, followed by the length of the
+// metadata holding the tag.
+const chunkHeaderSize = 24
+
+// readChunkFile reads the records of a chunk file. Files that do not start
+// with the header of the filesystem storage of Fluent Bit are taken to hold
+// msgpack records only.
+func readChunkFile(path string) (chunk, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return chunk{}, err
+	}
+
+	var c chunk
+	if len(b) >= chunkHeaderSize && b[0] == 0xC1 && b[1] == 0x00 {
+		n := int(binary.BigEndian.Uint16(b[chunkHeaderSize-2:]))
+		if len(b) < chunkHeaderSize+n {
+			return chunk{}, errors.New("truncated chunk header")
+		}
+		meta := b[chunkHeaderSize : chunkHeaderSize+n]
+		// Newer versions of Fluent Bit prefix the tag with two magic
+		// bytes, the event type and a reserved byte.
+		if len(meta) >= 4 && meta[0] == 0xF1 && meta[1] == 0x77 {
+			meta = meta[4:]
+		}
+		c.tag = string(meta)
+		b = b[chunkHeaderSize+n:]
+	}
+
+	c.records, err = decode(b)
+	return c, err
+}
+
+func decode(data []byte) ([]timedRecord, error) {
+	var records []timedRecord
+	dec := syslog.NewChunkDecoder(data)
+	for {
+		ts, record, err := dec.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %s", len(records)+1, err)
+		}
+		records = append(records, timedRecord{ts: ts, record: record})
+	}
+}
+
+// generate encodes n records like the ones of the kubernetes filter into a
+// chunk and decodes it, so that generated records take the same path as
+// recorded ones.
+func generate(n, pods int, namespaces []string, size int) (chunk, error) {
+	if pods < 1 {
+		pods = 1
+	}
+	var buf bytes.Buffer
+	enc := syslog.NewChunkEncoder(&buf)
+	body := strings.Repeat("x", size)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		ns := namespaces[i%len(namespaces)]
+		pod := fmt.Sprintf("replay-%d", (i/len(namespaces))%pods)
+		record := map[string]interface{}{
+			"log":    fmt.Sprintf("%d %s\n", i, body),
+			"stream": "stdout",
+			"kubernetes": map[string]interface{}{
+				"pod_name":       pod,
+				"namespace_name": ns,
+				"pod_id":         ns + "-" + pod,
+				"host":           "flb-replay",
+				"container_name": "replay",
+				"docker_id":      fmt.Sprintf("%064d", 0),
+				"labels": map[string]interface{}{
+					"app": "replay",
+				},
+			},
+		}
+		err := enc.Encode(start.Add(time.Duration(i)*time.Millisecond), record)
+		if err != nil {
+			return chunk{}, err
+		}
+	}
+
+	records, err := decode(buf.Bytes())
+	return chunk{records: records}, err
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "flb-replay: "+format+"\n", args...)
+	os.Exit(2)
+}
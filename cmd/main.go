@@ -2,42 +2,39 @@ package main
 
 import (
 	"C"
-	"encoding/json"
 	"log"
 	"runtime"
-	"strconv"
-	"strings"
 	"time"
 	"unsafe"
 
 	"github.com/fluent/fluent-bit-go/output"
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/config"
 	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
 )
 
+// outs are the instances of the plugin, which are flushed on exit.
+var outs []*syslog.Out
+
+// exitFlushTimeout limits how long each instance may take to write its
+// remaining messages on exit.
+const exitFlushTimeout = 5 * time.Second
+
 //export FLBPluginRegister
 func FLBPluginRegister(def unsafe.Pointer) int {
 	return output.FLBPluginRegister(
 		def,
-		"pivotal-syslog",
+		config.PluginName,
 		"syslog output plugin that follows RFC 5424",
 	)
 }
 
 //export FLBPluginInit
 func FLBPluginInit(plugin unsafe.Pointer) int {
-	addr := output.FLBPluginConfigKey(plugin, "addr")
-	name := output.FLBPluginConfigKey(plugin, "instancename")
-	namespace := output.FLBPluginConfigKey(plugin, "namespace")
-	cluster := output.FLBPluginConfigKey(plugin, "cluster")
-	tls := output.FLBPluginConfigKey(plugin, "tlsconfig")
-	sanitizeHost := output.FLBPluginConfigKey(plugin, "sanitizehost")
-
-	if addr == "" {
-		log.Println("[out_syslog] ERROR: Addr is required")
-		return output.FLB_ERROR
-	}
-	if name == "" {
-		log.Println("[out_syslog] ERROR: InstanceName is required")
+	cfg, err := config.Parse(func(key string) string {
+		return output.FLBPluginConfigKey(plugin, key)
+	})
+	if err != nil {
+		log.Printf("[out_syslog] ERROR: %s", err)
 		return output.FLB_ERROR
 	}
 
@@ -45,41 +42,16 @@ func FLBPluginInit(plugin unsafe.Pointer) int {
 		sinks        []*syslog.Sink
 		clusterSinks []*syslog.Sink
 	)
-
-	sink := &syslog.Sink{
-		Addr:      addr,
-		Name:      name,
-		Namespace: namespace,
-	}
-	if tls != "" {
-		var tlsConfig syslog.TLS
-		err := json.Unmarshal([]byte(tls), &tlsConfig)
-		if err != nil {
-			log.Printf("[out_syslog] ERROR: Unable to unmarshal TLS config: %s", err)
-			return output.FLB_ERROR
-		}
-		sink.TLS = &tlsConfig
-	}
-	if strings.ToLower(cluster) == "true" {
-		clusterSinks = append(clusterSinks, sink)
+	if cfg.Cluster {
+		clusterSinks = append(clusterSinks, cfg.Sink)
 	} else {
-		sinks = append(sinks, sink)
+		sinks = append(sinks, cfg.Sink)
 	}
 
-	// Defaults to true so that plugin conforms better with rfc5424#section-6.2.4
-	sanitize := true
-	if len(sanitizeHost) != 0 {
-		var err error
-		sanitize, err = strconv.ParseBool(sanitizeHost)
-		if err != nil {
-			log.Printf("[out_syslog] ERROR: Unable to parse SanitizeHost: %s", err)
-			return output.FLB_ERROR
-		}
-	}
 	out := syslog.NewOut(
 		sinks,
 		clusterSinks,
-		syslog.WithSanitizeHost(sanitize),
+		cfg.Options...,
 	)
 
 	// We are using runtime.KeepAlive to tell the Go Runtime to keep the
@@ -98,44 +70,22 @@ func FLBPluginInit(plugin unsafe.Pointer) int {
 	// on millions of sinks to be initialized.
 	output.FLBPluginSetContext(plugin, unsafe.Pointer(out))
 	runtime.KeepAlive(out)
-	if strings.ToLower(cluster) == "true" {
-		log.Printf("[out_syslog] Initializing plugin %s for cluster to destination %s", name, addr)
+	outs = append(outs, out)
+	if cfg.Cluster {
+		log.Printf("[out_syslog] Initializing plugin %s for cluster to destination %s", cfg.Sink.Name, syslog.RedactAddr(cfg.Sink.Addr))
 	} else {
-		log.Printf("[out_syslog] Initializing plugin %s for namespace %s to destination %s", name, namespace, addr)
+		log.Printf("[out_syslog] Initializing plugin %s for namespace %s to destination %s", cfg.Sink.Name, cfg.Sink.Namespace, syslog.RedactAddr(cfg.Sink.Addr))
 	}
 	return output.FLB_OK
 }
 
 //export FLBPluginFlushCtx
 func FLBPluginFlushCtx(ctx, data unsafe.Pointer, length C.int, tag *C.char) int {
-	var (
-		ret    int
-		ts     interface{}
-		record map[interface{}]interface{}
-	)
-
 	out := (*syslog.Out)(ctx)
 
-	dec := output.NewDecoder(data, int(length))
-	for {
-		ret, ts, record = output.GetRecord(dec)
-		if ret != 0 {
-			break
-		}
-
-		var timestamp time.Time
-		switch tts := ts.(type) {
-		case output.FLBTime:
-			timestamp = tts.Time
-		case uint64:
-			// From our observation, when ts is of type uint64 it appears to
-			// be the amount of seconds since unix epoch.
-			timestamp = time.Unix(int64(tts), 0)
-		default:
-			timestamp = time.Now()
-		}
-
-		out.Write(record, timestamp, C.GoString(tag))
+	_, err := out.WriteChunk(C.GoBytes(data, length), C.GoString(tag))
+	if err != nil {
+		log.Printf("[out_syslog] ERROR: Unable to decode record: %s", err)
 	}
 
 	return output.FLB_OK
@@ -143,6 +93,13 @@ func FLBPluginFlushCtx(ctx, data unsafe.Pointer, length C.int, tag *C.char) int
 
 //export FLBPluginExit
 func FLBPluginExit() int {
+	// Multiline log events that are still being assembled and queued
+	// messages are written before exiting rather than lost.
+	for _, out := range outs {
+		if !out.Flush(exitFlushTimeout) {
+			log.Printf("[out_syslog] Unable to write all messages within %s on exit", exitFlushTimeout)
+		}
+	}
 	// TODO: We should probably call conn.Close() for each sink connection
 	return output.FLB_OK
 }
@@ -0,0 +1,137 @@
+// Command out-syslog-check validates the configuration of the syslog output
+// plugin without running Fluent Bit.
+//
+// It reads a Fluent Bit configuration file, including the files it
+// includes, and checks every output section of the plugin: all keys are
+// parsed, unknown keys reported, root CAs loaded and instance names checked
+// for uniqueness. With -dial every address of the sinks is connected to.
+// Sinks may also be given as -o Key=Value flags as for syslog-send. The
+// exit status is 1 if any errors were found.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/config"
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+type output struct {
+	location string
+	keys     map[string]string
+}
+
+func main() {
+	var sections config.Sections
+	sections.RegisterFlags(flag.CommandLine)
+	dial := flag.Bool("dial", false, "connect to the addresses of the sinks")
+	timeout := flag.Duration("timeout", 5*time.Second, "timeout for connecting to an address")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [fluent-bit.conf ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var outputs []output
+	for _, path := range flag.Args() {
+		fileSections, err := config.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "out-syslog-check: %s\n", err)
+			os.Exit(2)
+		}
+		for _, s := range fileSections {
+			if strings.EqualFold(s.Name, "OUTPUT") && strings.EqualFold(s.Keys["name"], config.PluginName) {
+				outputs = append(outputs, output{
+					location: fmt.Sprintf("%s:%d", s.File, s.Line),
+					keys:     s.Keys,
+				})
+			}
+		}
+	}
+	for i, keys := range sections {
+		outputs = append(outputs, output{
+			location: fmt.Sprintf("sink %d", i+1),
+			keys:     keys,
+		})
+	}
+	if len(outputs) == 0 {
+		fmt.Fprintf(os.Stderr, "out-syslog-check: no output section with Name %s found\n", config.PluginName)
+		os.Exit(2)
+	}
+
+	var errors, warnings int
+	names := make(map[string]string)
+	for _, o := range outputs {
+		r := config.Validate(o.keys)
+		if name := o.keys["instancename"]; name != "" {
+			if first, ok := names[name]; ok {
+				r.Errors = append(r.Errors, fmt.Sprintf("InstanceName %s is also used at %s", name, first))
+			} else {
+				names[name] = o.location
+			}
+		}
+
+		fmt.Printf("%s: %s\n", o.location, describe(o.keys))
+		for _, e := range r.Errors {
+			fmt.Printf("  error: %s\n", e)
+		}
+		for _, w := range r.Warnings {
+			fmt.Printf("  warning: %s\n", w)
+		}
+		errors += len(r.Errors)
+		warnings += len(r.Warnings)
+
+		if *dial && r.Config != nil {
+			errors += probe(r.Config.Sink, *timeout)
+		}
+	}
+
+	fmt.Printf("%d outputs checked, %d errors, %d warnings\n", len(outputs), errors, warnings)
+	if errors != 0 {
+		os.Exit(1)
+	}
+}
+
+func describe(keys map[string]string) string {
+	name := keys["instancename"]
+	if name == "" {
+		name = "(no InstanceName)"
+	}
+	if strings.EqualFold(keys["cluster"], "true") {
+		return name + " for the cluster"
+	}
+	return fmt.Sprintf("%s for namespace %q", name, keys["namespace"])
+}
+
+// probe connects to the addresses of a sink, prints the results and returns
+// the number of errors.
+func probe(s *syslog.Sink, timeout time.Duration) int {
+	results, err := syslog.Probe(s, syslog.WithDialTimeout(timeout))
+	errors := 0
+	if err != nil {
+		fmt.Printf("  error: unable to resolve addresses: %s\n", err)
+		errors++
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("  error: dial %s: %s\n", r.Addr, r.Err)
+			errors++
+			continue
+		}
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			fmt.Printf("  dial %s: ok\n", r.Addr)
+			continue
+		}
+		cert := r.TLS.PeerCertificates[0]
+		fmt.Printf("  dial %s: ok, certificate %q valid until %s\n",
+			r.Addr,
+			cert.Subject.String(),
+			cert.NotAfter.UTC().Format(time.RFC3339),
+		)
+	}
+	return errors
+}
@@ -0,0 +1,126 @@
+// Command syslog-recv receives syslog messages over TCP, TLS or UDP,
+// validates them strictly against RFC 5424 and writes them as JSON lines,
+// to check the output of the plugin end to end.
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/receiver"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:5514", "address to listen on")
+	transport := flag.String("transport", "tcp", "transport: tcp, tls or udp")
+	certFile := flag.String("cert", "", "certificate of the TLS listener")
+	keyFile := flag.String("key", "", "private key of the TLS listener")
+	framingName := flag.String("framing", "auto", "framing of TCP and TLS streams: auto, octet-counted or newline")
+	maxFrameSize := flag.Int("max-frame-size", receiver.DefaultMaxFrameSize, "maximum size of a frame in bytes")
+	output := flag.String("output", "-", "file to append the JSON lines to, - for stdout")
+	count := flag.Int("count", 0, "exit after receiving that many messages, 0 to run until interrupted")
+	flag.Parse()
+
+	framing, err := receiver.ParseFraming(*framingName)
+	if err != nil {
+		fatalf("%s", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			fatalf("unable to open output: %s", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+
+	var (
+		mu       sync.Mutex
+		received int
+		invalid  int
+		done     = make(chan struct{})
+	)
+	r := &receiver.Receiver{
+		Framing:      framing,
+		MaxFrameSize: *maxFrameSize,
+		Handle: func(rec receiver.Record) {
+			if err := enc.Encode(rec); err != nil {
+				fmt.Fprintf(os.Stderr, "syslog-recv: unable to write record: %s\n", err)
+			}
+			if rec.Message == nil && rec.Frame == "" {
+				// Connection errors are not messages.
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			received++
+			if !rec.Valid {
+				invalid++
+			}
+			if received == *count {
+				close(done)
+			}
+		},
+	}
+
+	switch *transport {
+	case "udp":
+		pc, err := net.ListenPacket("udp", *listen)
+		if err != nil {
+			fatalf("unable to listen: %s", err)
+		}
+		defer pc.Close()
+		go func() {
+			_ = r.ServePacket(pc)
+		}()
+	case "tcp", "tls":
+		l, err := net.Listen("tcp", *listen)
+		if err != nil {
+			fatalf("unable to listen: %s", err)
+		}
+		if *transport == "tls" {
+			cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+			if err != nil {
+				fatalf("unable to load certificate: %s", err)
+			}
+			l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}})
+		}
+		defer l.Close()
+		go func() {
+			_ = r.Serve(l)
+		}()
+	default:
+		fatalf("unknown transport %q", *transport)
+	}
+	fmt.Fprintf(os.Stderr, "syslog-recv: listening on %s %s\n", *transport, *listen)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-signals:
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	fmt.Fprintf(os.Stderr, "syslog-recv: received %d messages, %d invalid\n", received, invalid)
+	if invalid != 0 {
+		os.Exit(1)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "syslog-recv: "+format+"\n", args...)
+	os.Exit(2)
+}
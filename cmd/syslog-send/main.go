@@ -0,0 +1,292 @@
+// Command syslog-send sends records through the syslog output plugin's
+// sinks without running Fluent Bit, to debug the configuration of a drain.
+//
+// Each sink is configured with the keys of the plugin's output section,
+// given as -o Key=Value flags; -sink starts the configuration of another
+// sink. The records are either synthetic or read from stdin, one message
+// per line. For every sink the result of a TLS handshake and the number of
+// messages sent and dropped are printed.
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/config"
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+func main() {
+	var configs config.Sections
+	configs.RegisterFlags(flag.CommandLine)
+	count := flag.Int("count", 1, "number of synthetic records to send")
+	message := flag.String("message", "test message from syslog-send", "body of the synthetic records")
+	stdin := flag.Bool("stdin", false, "send the lines read from stdin instead of synthetic records")
+	namespace := flag.String("namespace", "", "namespace of the records (default the sink's namespace)")
+	pod := flag.String("pod", "syslog-send", "pod name of the records")
+	container := flag.String("container", "syslog-send", "container name of the records")
+	tag := flag.String("tag", "pod.log", "tag of the records")
+	timeout := flag.Duration("timeout", 10*time.Second, "how long to wait for the messages to be sent")
+	flag.Parse()
+
+	if len(configs) == 0 {
+		fmt.Fprintln(os.Stderr, "syslog-send: no sink configured, use -o Addr=host:port")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	bodies, err := messages(*stdin, *count, *message)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "syslog-send: unable to read stdin: %s\n", err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for i, c := range configs {
+		if c["instancename"] == "" {
+			c["instancename"] = fmt.Sprintf("sink-%d", i+1)
+		}
+		cfg, err := config.Parse(func(key string) string {
+			return c[key]
+		})
+		if err != nil {
+			fmt.Printf("sink %s: invalid configuration: %s\n", c["instancename"], err)
+			failed = true
+			continue
+		}
+
+		ns := *namespace
+		if ns == "" {
+			ns = cfg.Sink.Namespace
+		}
+		if ns == "" {
+			ns = "default"
+		}
+		records := make([]map[interface{}]interface{}, len(bodies))
+		for j, b := range bodies {
+			records[j] = record(b, ns, *pod, *container)
+		}
+
+		if !send(cfg, records, *tag, *timeout) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func messages(stdin bool, count int, message string) ([]string, error) {
+	if !stdin {
+		bodies := make([]string, count)
+		for i := range bodies {
+			bodies[i] = fmt.Sprintf("%s %d", message, i+1)
+		}
+		return bodies, nil
+	}
+
+	var bodies []string
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		bodies = append(bodies, scanner.Text())
+	}
+	return bodies, scanner.Err()
+}
+
+// record returns a record like the ones of the kubernetes filter.
+func record(body, namespace, pod, container string) map[interface{}]interface{} {
+	return map[interface{}]interface{}{
+		"log":    []byte(body + "\n"),
+		"stream": []byte("stdout"),
+		"kubernetes": map[interface{}]interface{}{
+			"namespace_name": []byte(namespace),
+			"pod_name":       []byte(pod),
+			"container_name": []byte(container),
+			"host":           []byte("syslog-send"),
+		},
+	}
+}
+
+// send writes the records to the configured sink and prints the results. It
+// reports whether all messages were sent.
+func send(cfg *config.Config, records []map[interface{}]interface{}, tag string, timeout time.Duration) bool {
+	s := cfg.Sink
+	scope := "namespace " + s.Namespace
+	if cfg.Cluster {
+		scope = "cluster"
+	}
+	fmt.Printf("sink %s (%s) to %s\n", s.Name, scope, describeAddr(s))
+	handshake(s)
+
+	var sinks, clusterSinks []*syslog.Sink
+	if cfg.Cluster {
+		clusterSinks = []*syslog.Sink{s}
+	} else {
+		sinks = []*syslog.Sink{s}
+	}
+	out := syslog.NewOut(sinks, clusterSinks, cfg.Options...)
+
+	start := time.Now()
+	for _, r := range records {
+		out.Write(r, time.Now(), tag)
+	}
+	out.Flush(timeout)
+
+	want := int64(len(records))
+	deadline := start.Add(timeout)
+	for time.Now().Before(deadline) {
+		if s.MessagesSent()+s.MessagesDropped()+s.MessagesSuppressed() >= want {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	sent := s.MessagesSent()
+	fmt.Printf("  sent %d of %d messages in %s\n", sent, want, time.Since(start).Round(time.Millisecond))
+	counters := []struct {
+		name  string
+		value int64
+	}{
+		{"dropped", s.MessagesDropped()},
+		{"retried", s.MessagesRetried()},
+		{"resent", s.MessagesResent()},
+		{"suppressed", s.MessagesSuppressed()},
+		{"oversized", s.MessagesOversized()},
+	}
+	for _, c := range counters {
+		if c.value != 0 {
+			fmt.Printf("  %s %d\n", c.name, c.value)
+		}
+	}
+	for _, st := range out.SinkState() {
+		if st.Error != nil {
+			fmt.Printf("  last error at %s: %s\n", st.Error.Timestamp.Format(time.RFC3339), st.Error.Msg)
+		}
+		for _, m := range st.Pool {
+			if m.Error != nil {
+				fmt.Printf("  last error of %s at %s: %s\n", m.ActiveAddr, m.Error.Timestamp.Format(time.RFC3339), m.Error.Msg)
+			}
+		}
+	}
+	return sent >= want
+}
+
+func describeAddr(s *syslog.Sink) string {
+	switch {
+	case len(s.BalanceAddrs) != 0:
+		return "balanced " + strings.Join(s.BalanceAddrs, ",")
+	case s.BalanceHost != "":
+		return "balanced host " + s.BalanceHost
+	case s.BalanceSRV != "":
+		return "balanced SRV " + s.BalanceSRV
+	case s.SRV != "":
+		return "SRV " + s.SRV
+	}
+	if len(s.FailoverAddrs) != 0 {
+		addrs := make([]string, len(s.FailoverAddrs))
+		for i, a := range s.FailoverAddrs {
+			addrs[i] = syslog.RedactAddr(a)
+		}
+		return syslog.RedactAddr(s.Addr) + " failing over to " + strings.Join(addrs, ",")
+	}
+	return syslog.RedactAddr(s.Addr)
+}
+
+// handshake establishes a TLS connection to the address of a sink using TLS
+// or an HTTPS drain and prints the negotiated parameters and the server's
+// certificates.
+func handshake(s *syslog.Sink) {
+	addr := s.Addr
+	t := s.TLS
+	if strings.HasPrefix(addr, "https://") {
+		u, err := url.Parse(addr)
+		if err != nil {
+			fmt.Printf("  invalid URL: %s\n", err)
+			return
+		}
+		addr = u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		}
+		if t == nil {
+			t = &syslog.TLS{}
+		}
+	}
+	if t == nil || addr == "" || strings.Contains(addr, "://") {
+		return
+	}
+
+	cfg, err := t.ClientConfig("")
+	if err != nil {
+		fmt.Printf("  tls: unable to load configuration: %s\n", err)
+		return
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, cfg)
+	if err != nil {
+		fmt.Printf("  tls: handshake with %s failed: %s\n", addr, err)
+		return
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	fmt.Printf("  tls: %s, %s, server name %q\n", tlsVersion(state.Version), cipherSuite(state.CipherSuite), state.ServerName)
+	if t.InsecureSkipVerify {
+		fmt.Println("  tls: certificate verification skipped")
+	}
+	for i, cert := range state.PeerCertificates {
+		fmt.Printf("  certificate %d: subject %q, issuer %q, valid %s to %s\n",
+			i,
+			cert.Subject.String(),
+			cert.Issuer.String(),
+			cert.NotBefore.UTC().Format(time.RFC3339),
+			cert.NotAfter.UTC().Format(time.RFC3339),
+		)
+		if len(cert.DNSNames) != 0 {
+			fmt.Printf("    DNS names %s\n", strings.Join(cert.DNSNames, ", "))
+		}
+	}
+}
+
+func tlsVersion(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("TLS version 0x%04x", v)
+}
+
+var cipherSuites = map[uint16]string{
+	tls.TLS_AES_128_GCM_SHA256:                  "TLS_AES_128_GCM_SHA256",
+	tls.TLS_AES_256_GCM_SHA384:                  "TLS_AES_256_GCM_SHA384",
+	tls.TLS_CHACHA20_POLY1305_SHA256:            "TLS_CHACHA20_POLY1305_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:   "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305:    "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305",
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305:  "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:         "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:         "TLS_RSA_WITH_AES_256_GCM_SHA384",
+}
+
+func cipherSuite(id uint16) string {
+	if name, ok := cipherSuites[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("cipher suite 0x%04x", id)
+}
@@ -0,0 +1,537 @@
+// Package config parses the configuration keys of the syslog output plugin
+// so that the plugin and the tools that share its configuration interpret
+// them the same way.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+// Config is the configuration of a single output plugin instance.
+type Config struct {
+	// Cluster is set if the sink receives the messages of all namespaces.
+	Cluster bool
+	Sink    *syslog.Sink
+	Options []syslog.OutOption
+}
+
+// Error lists the problems of a configuration.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// Parse parses the configuration of an output plugin instance. get returns
+// the value of the given lower case key, or an empty string if it is not
+// set. All keys are parsed; if any of them are invalid an *Error listing
+// every problem is returned.
+func Parse(get func(key string) string) (*Config, error) {
+	cfg, problems := parse(get)
+	if len(problems) != 0 {
+		return nil, &Error{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// parse returns the configuration along with its problems. The
+// configuration is returned even if there are problems, with the invalid
+// keys unset.
+func parse(get func(key string) string) (*Config, []string) {
+	addr := get("addr")
+	name := get("instancename")
+	namespace := get("namespace")
+	cluster := get("cluster")
+	tls := get("tlsconfig")
+	sanitizeHost := get("sanitizehost")
+	maxMessageSize := get("maxmessagesize")
+	sizePolicy := get("messagesizepolicy")
+	redactionRules := get("redactionrules")
+	redactionDetectors := get("redactiondetectors")
+	rateLimit := get("ratelimit")
+	namespaceRateLimit := get("namespaceratelimit")
+	suppressionInterval := get("suppressionreportinterval")
+	namespaceWeights := get("namespaceweights")
+	queueSize := get("queuesize")
+	overflowPolicy := get("overflowpolicy")
+	overflowTimeout := get("overflowtimeout")
+	retryMaxAttempts := get("retrymaxattempts")
+	retryMaxAge := get("retrymaxage")
+	retryInitialBackoff := get("retryinitialbackoff")
+	retryMaxBackoff := get("retrymaxbackoff")
+	breakerThreshold := get("circuitbreakerthreshold")
+	breakerOpenTimeout := get("circuitbreakeropentimeout")
+	breakerPark := get("circuitbreakerpark")
+	failoverAddrs := get("failoveraddrs")
+	failbackInterval := get("failbackinterval")
+	balanceAddrs := get("balanceaddrs")
+	balanceHost := get("balancehost")
+	balancePolicy := get("balancepolicy")
+	balanceSRV := get("balancesrv")
+	srv := get("srv")
+	resolveInterval := get("resolveinterval")
+	maxConnectionAge := get("maxconnectionage")
+	idleTimeout := get("idletimeout")
+	keepAlive := get("keepalive")
+	protocol := get("protocol")
+	relpWindow := get("relpwindow")
+	writeBufferSize := get("writebuffersize")
+	writeLinger := get("writelinger")
+	httpFraming := get("httpframing")
+	httpHeaders := get("httpheaders")
+	httpGzip := get("httpgzip")
+	httpBatchSize := get("httpbatchsize")
+	httpBatchAge := get("httpbatchage")
+	httpTimeout := get("httptimeout")
+	conversionWorkers := get("conversionworkers")
+	metadataCacheSize := get("metadatacachesize")
+	metadataCacheTTL := get("metadatacachettl")
+	multilinePatterns := get("multilinestartpatterns")
+	multilineTimeout := get("multilineflushtimeout")
+	multilineMaxLines := get("multilinemaxlines")
+
+	var problems []string
+	if addr == "" && srv == "" && balanceAddrs == "" && balanceHost == "" && balanceSRV == "" {
+		problems = append(problems, "Addr is required")
+	}
+	if name == "" {
+		problems = append(problems, "InstanceName is required")
+	}
+
+	sink := &syslog.Sink{
+		Addr:      addr,
+		Name:      name,
+		Namespace: namespace,
+	}
+	if tls != "" {
+		var tlsConfig syslog.TLS
+		err := json.Unmarshal([]byte(tls), &tlsConfig)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to unmarshal TLS config: %s", err))
+		} else {
+			sink.TLS = &tlsConfig
+		}
+	}
+	if maxMessageSize != "" {
+		size, err := strconv.Atoi(maxMessageSize)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to parse MaxMessageSize: %s", err))
+		}
+		sink.MaxMessageSize = size
+	}
+	policy, err := syslog.ParseSizePolicy(strings.ToLower(sizePolicy))
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("unable to parse MessageSizePolicy: %s", err))
+	}
+	sink.SizePolicy = policy
+	sink.Redaction, err = parseRedaction(redactionRules, redactionDetectors)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("unable to parse redaction config: %s", err))
+	}
+	if rateLimit != "" {
+		sink.RateLimit = &syslog.RateLimit{}
+		err = json.Unmarshal([]byte(rateLimit), sink.RateLimit)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to unmarshal RateLimit: %s", err))
+			sink.RateLimit = nil
+		}
+	}
+	if namespaceRateLimit != "" {
+		sink.NamespaceRateLimit = &syslog.RateLimit{}
+		err = json.Unmarshal([]byte(namespaceRateLimit), sink.NamespaceRateLimit)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to unmarshal NamespaceRateLimit: %s", err))
+			sink.NamespaceRateLimit = nil
+		}
+	}
+	if namespaceWeights != "" {
+		err = json.Unmarshal([]byte(namespaceWeights), &sink.NamespaceWeights)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to unmarshal NamespaceWeights: %s", err))
+		}
+	}
+	if queueSize != "" {
+		sink.QueueSize, err = strconv.Atoi(queueSize)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to parse QueueSize: %s", err))
+		}
+	}
+	sink.OverflowPolicy, err = syslog.ParseOverflowPolicy(strings.ToLower(overflowPolicy))
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("unable to parse OverflowPolicy: %s", err))
+	}
+	sink.Retry, err = parseRetry(retryMaxAttempts, retryMaxAge, retryInitialBackoff, retryMaxBackoff)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("unable to parse retry config: %s", err))
+	}
+	sink.CircuitBreaker, err = parseCircuitBreaker(breakerThreshold, breakerOpenTimeout, breakerPark)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("unable to parse circuit breaker config: %s", err))
+	}
+	if failoverAddrs != "" {
+		for _, a := range strings.Split(failoverAddrs, ",") {
+			sink.FailoverAddrs = append(sink.FailoverAddrs, strings.TrimSpace(a))
+		}
+	}
+	if balanceAddrs != "" {
+		for _, a := range strings.Split(balanceAddrs, ",") {
+			sink.BalanceAddrs = append(sink.BalanceAddrs, strings.TrimSpace(a))
+		}
+	}
+	sink.BalanceHost = balanceHost
+	sink.BalanceSRV = balanceSRV
+	sink.SRV = srv
+	sink.BalancePolicy, err = syslog.ParseBalancePolicy(strings.ToLower(balancePolicy))
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("unable to parse BalancePolicy: %s", err))
+	}
+	sink.Protocol, err = syslog.ParseProtocol(strings.ToLower(protocol))
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("unable to parse Protocol: %s", err))
+	}
+	if relpWindow != "" {
+		sink.RELPWindow, err = strconv.Atoi(relpWindow)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to parse RELPWindow: %s", err))
+		}
+	}
+	if writeBufferSize != "" {
+		sink.WriteBufferSize, err = strconv.Atoi(writeBufferSize)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to parse WriteBufferSize: %s", err))
+		}
+	}
+	sink.HTTP, err = parseHTTPDrain(httpFraming, httpHeaders, httpGzip, httpBatchSize, httpBatchAge, httpTimeout)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("unable to parse HTTP drain config: %s", err))
+	}
+	durations := []struct {
+		key   string
+		value string
+		dst   *time.Duration
+	}{
+		{"OverflowTimeout", overflowTimeout, &sink.OverflowTimeout},
+		{"FailbackInterval", failbackInterval, &sink.FailbackInterval},
+		{"ResolveInterval", resolveInterval, &sink.ResolveInterval},
+		{"MaxConnectionAge", maxConnectionAge, &sink.MaxConnectionAge},
+		{"IdleTimeout", idleTimeout, &sink.IdleTimeout},
+		{"KeepAlive", keepAlive, &sink.KeepAlive},
+		{"WriteLinger", writeLinger, &sink.WriteLinger},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		*d.dst, err = time.ParseDuration(d.value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to parse %s: %s", d.key, err))
+		}
+	}
+
+	// Defaults to true so that plugin conforms better with rfc5424#section-6.2.4
+	sanitize := true
+	if len(sanitizeHost) != 0 {
+		sanitize, err = strconv.ParseBool(sanitizeHost)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to parse SanitizeHost: %s", err))
+		}
+	}
+	opts := []syslog.OutOption{
+		syslog.WithSanitizeHost(sanitize),
+	}
+
+	if suppressionInterval != "" {
+		d, err := time.ParseDuration(suppressionInterval)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to parse SuppressionReportInterval: %s", err))
+		} else if d <= 0 {
+			problems = append(problems, "SuppressionReportInterval must be positive")
+		}
+		opts = append(opts, syslog.WithSuppressionReportInterval(d))
+	}
+	if conversionWorkers != "" {
+		n, err := strconv.Atoi(conversionWorkers)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to parse ConversionWorkers: %s", err))
+		}
+		opts = append(opts, syslog.WithConversionWorkers(n))
+	}
+	if metadataCacheSize != "" || metadataCacheTTL != "" {
+		var (
+			size int
+			ttl  time.Duration
+		)
+		if metadataCacheSize != "" {
+			size, err = strconv.Atoi(metadataCacheSize)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("unable to parse MetadataCacheSize: %s", err))
+			}
+		}
+		if metadataCacheTTL != "" {
+			ttl, err = time.ParseDuration(metadataCacheTTL)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("unable to parse MetadataCacheTTL: %s", err))
+			}
+		}
+		opts = append(opts, syslog.WithMetadataCache(size, ttl))
+	}
+
+	// Values that parse but make no sense once the plugin runs.
+	counts := []struct {
+		key   string
+		value string
+	}{
+		{"MaxMessageSize", maxMessageSize},
+		{"QueueSize", queueSize},
+		{"RetryMaxAttempts", retryMaxAttempts},
+		{"CircuitBreakerThreshold", breakerThreshold},
+		{"RELPWindow", relpWindow},
+		{"WriteBufferSize", writeBufferSize},
+		{"HTTPBatchSize", httpBatchSize},
+		{"ConversionWorkers", conversionWorkers},
+		{"MetadataCacheSize", metadataCacheSize},
+		{"MultilineMaxLines", multilineMaxLines},
+	}
+	for _, c := range counts {
+		if n, err := strconv.Atoi(c.value); err == nil && n < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative", c.key))
+		}
+	}
+	// KeepAlive is left out, a negative value disables keepalives.
+	periods := []struct {
+		key   string
+		value string
+	}{
+		{"OverflowTimeout", overflowTimeout},
+		{"FailbackInterval", failbackInterval},
+		{"ResolveInterval", resolveInterval},
+		{"MaxConnectionAge", maxConnectionAge},
+		{"IdleTimeout", idleTimeout},
+		{"WriteLinger", writeLinger},
+		{"RetryMaxAge", retryMaxAge},
+		{"RetryInitialBackoff", retryInitialBackoff},
+		{"RetryMaxBackoff", retryMaxBackoff},
+		{"CircuitBreakerOpenTimeout", breakerOpenTimeout},
+		{"HTTPBatchAge", httpBatchAge},
+		{"HTTPTimeout", httpTimeout},
+		{"MetadataCacheTTL", metadataCacheTTL},
+	}
+	for _, d := range periods {
+		if v, err := time.ParseDuration(d.value); err == nil && v < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative", d.key))
+		}
+	}
+	if d, err := time.ParseDuration(multilineTimeout); err == nil && d < syslog.MinMultilineFlushTimeout {
+		problems = append(problems, fmt.Sprintf("MultilineFlushTimeout must be at least %s", syslog.MinMultilineFlushTimeout))
+	}
+
+	if multilinePatterns != "" {
+		ml, err := parseMultiline(multilinePatterns, multilineTimeout, multilineMaxLines)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to parse multiline config: %s", err))
+		}
+		opts = append(opts, syslog.WithMultiline(ml))
+	}
+
+	return &Config{
+		Cluster: strings.ToLower(cluster) == "true",
+		Sink:    sink,
+		Options: opts,
+	}, problems
+}
+
+// parseRedaction parses the redaction settings. Custom rules are given as a
+// JSON array of objects with a pattern and a replacement, built in detectors
+// as a comma separated list of names.
+func parseRedaction(rules, detectors string) ([]syslog.RedactionRule, error) {
+	var redaction []syslog.RedactionRule
+	if detectors != "" {
+		names := strings.Split(detectors, ",")
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+		builtin, err := syslog.BuiltinRedactionRules(names...)
+		if err != nil {
+			return nil, err
+		}
+		redaction = append(redaction, builtin...)
+	}
+	if rules != "" {
+		var custom []struct {
+			Pattern     string `json:"pattern"`
+			Replacement string `json:"replacement"`
+		}
+		err := json.Unmarshal([]byte(rules), &custom)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range custom {
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			redaction = append(redaction, syslog.RedactionRule{
+				Pattern:     re,
+				Replacement: r.Replacement,
+			})
+		}
+	}
+	return redaction, nil
+}
+
+// parseRetry parses the retry settings. It returns nil if none are set,
+// which disables retries.
+func parseRetry(maxAttempts, maxAge, initialBackoff, maxBackoff string) (*syslog.RetryPolicy, error) {
+	if maxAttempts == "" && maxAge == "" && initialBackoff == "" && maxBackoff == "" {
+		return nil, nil
+	}
+
+	var (
+		p   syslog.RetryPolicy
+		err error
+	)
+	if maxAttempts != "" {
+		p.MaxAttempts, err = strconv.Atoi(maxAttempts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	durations := []struct {
+		value string
+		dst   *time.Duration
+	}{
+		{maxAge, &p.MaxAge},
+		{initialBackoff, &p.InitialBackoff},
+		{maxBackoff, &p.MaxBackoff},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		*d.dst, err = time.ParseDuration(d.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// parseCircuitBreaker parses the circuit breaker settings. It returns nil
+// if no threshold is set, which disables the circuit breaker.
+func parseCircuitBreaker(threshold, openTimeout, park string) (*syslog.CircuitBreaker, error) {
+	if threshold == "" {
+		return nil, nil
+	}
+
+	var (
+		c   syslog.CircuitBreaker
+		err error
+	)
+	c.FailureThreshold, err = strconv.Atoi(threshold)
+	if err != nil {
+		return nil, err
+	}
+	if openTimeout != "" {
+		c.OpenTimeout, err = time.ParseDuration(openTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if park != "" {
+		c.ParkMessages, err = strconv.ParseBool(park)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// parseHTTPDrain parses the settings of HTTPS drains. The headers are given
+// as a JSON object.
+func parseHTTPDrain(framing, headers, gz, batchSize, batchAge, timeout string) (*syslog.HTTPDrain, error) {
+	var (
+		d   syslog.HTTPDrain
+		err error
+	)
+	d.Framing, err = syslog.ParseHTTPFraming(strings.ToLower(framing))
+	if err != nil {
+		return nil, err
+	}
+	if headers != "" {
+		err = json.Unmarshal([]byte(headers), &d.Headers)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if gz != "" {
+		d.Gzip, err = strconv.ParseBool(gz)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if batchSize != "" {
+		d.BatchSize, err = strconv.Atoi(batchSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	durations := []struct {
+		value string
+		dst   *time.Duration
+	}{
+		{batchAge, &d.BatchAge},
+		{timeout, &d.Timeout},
+	}
+	for _, dur := range durations {
+		if dur.value == "" {
+			continue
+		}
+		*dur.dst, err = time.ParseDuration(dur.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &d, nil
+}
+
+// parseMultiline parses the multiline settings. The start patterns are
+// given as a JSON array of regular expressions.
+func parseMultiline(patterns, timeout, maxLines string) (syslog.Multiline, error) {
+	var (
+		ml   syslog.Multiline
+		exps []string
+	)
+	err := json.Unmarshal([]byte(patterns), &exps)
+	if err != nil {
+		return ml, err
+	}
+	for _, e := range exps {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			return ml, err
+		}
+		ml.StartPatterns = append(ml.StartPatterns, re)
+	}
+	if timeout != "" {
+		ml.FlushTimeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return ml, err
+		}
+	}
+	if maxLines != "" {
+		ml.MaxLines, err = strconv.Atoi(maxLines)
+		if err != nil {
+			return ml, err
+		}
+	}
+	return ml, nil
+}
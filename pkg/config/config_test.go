@@ -0,0 +1,118 @@
+package config_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/config"
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Parse", func() {
+	parse := func(keys map[string]string) (*config.Config, error) {
+		return config.Parse(func(key string) string {
+			return keys[key]
+		})
+	}
+
+	It("parses the sink", func() {
+		cfg, err := parse(map[string]string{
+			"addr":             "localhost:6514",
+			"instancename":     "some-name",
+			"namespace":        "ns1",
+			"tlsconfig":        `{"insecure_skip_verify":true}`,
+			"failoveraddrs":    "backup-1:6514, backup-2:6514",
+			"retrymaxattempts": "3",
+			"idletimeout":      "1m",
+			"protocol":         "RELP",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(cfg.Cluster).To(BeFalse())
+		Expect(cfg.Sink.Addr).To(Equal("localhost:6514"))
+		Expect(cfg.Sink.Name).To(Equal("some-name"))
+		Expect(cfg.Sink.Namespace).To(Equal("ns1"))
+		Expect(cfg.Sink.TLS).To(Equal(&syslog.TLS{InsecureSkipVerify: true}))
+		Expect(cfg.Sink.FailoverAddrs).To(Equal([]string{"backup-1:6514", "backup-2:6514"}))
+		Expect(cfg.Sink.Retry.MaxAttempts).To(Equal(3))
+		Expect(cfg.Sink.IdleTimeout).To(Equal(time.Minute))
+		Expect(cfg.Sink.Protocol).To(Equal(syslog.ProtocolRELP))
+		Expect(cfg.Options).To(HaveLen(1))
+	})
+
+	It("parses cluster sinks", func() {
+		cfg, err := parse(map[string]string{
+			"addr":         "localhost:6514",
+			"instancename": "some-name",
+			"cluster":      "True",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg.Cluster).To(BeTrue())
+	})
+
+	It("requires an address", func() {
+		_, err := parse(map[string]string{
+			"instancename": "some-name",
+		})
+		Expect(err).To(MatchError("Addr is required"))
+	})
+
+	It("requires an instance name", func() {
+		_, err := parse(map[string]string{
+			"addr": "localhost:6514",
+		})
+		Expect(err).To(MatchError("InstanceName is required"))
+	})
+
+	It("names the key that can not be parsed", func() {
+		_, err := parse(map[string]string{
+			"addr":         "localhost:6514",
+			"instancename": "some-name",
+			"sanitizehost": "maybe",
+		})
+		Expect(err).To(MatchError(ContainSubstring("unable to parse SanitizeHost")))
+
+		_, err = parse(map[string]string{
+			"addr":         "localhost:6514",
+			"instancename": "some-name",
+			"tlsconfig":    "{",
+		})
+		Expect(err).To(MatchError(ContainSubstring("unable to unmarshal TLS config")))
+	})
+
+	It("reports all problems", func() {
+		_, err := parse(map[string]string{
+			"addr":        "localhost:6514",
+			"queuesize":   "many",
+			"idletimeout": "1 minute",
+		})
+		Expect(err).To(BeAssignableToTypeOf(&config.Error{}))
+		Expect(err.(*config.Error).Problems).To(ConsistOf(
+			"InstanceName is required",
+			ContainSubstring("unable to parse QueueSize"),
+			ContainSubstring("unable to parse IdleTimeout"),
+		))
+	})
+
+	It("rejects suppression report intervals that are not positive", func() {
+		for _, interval := range []string{"0s", "-1s"} {
+			_, err := parse(map[string]string{
+				"addr":                      "localhost:6514",
+				"instancename":              "some-name",
+				"suppressionreportinterval": interval,
+			})
+			Expect(err).To(MatchError("SuppressionReportInterval must be positive"), interval)
+		}
+	})
+	It("accepts a negative keepalive to disable keepalives", func() {
+		cfg, err := parse(map[string]string{
+			"addr":         "localhost:6514",
+			"instancename": "some-name",
+			"keepalive":    "-1s",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg.Sink.KeepAlive).To(Equal(-time.Second))
+	})
+})
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxIncludeDepth limits nested @INCLUDE directives, which also stops
+// files from including themselves.
+const maxIncludeDepth = 16
+
+// FileSection is a section of a Fluent Bit configuration file such as
+// [OUTPUT]. Keys are lower case, as Fluent Bit does not distinguish their
+// case.
+type FileSection struct {
+	Name string
+	File string
+	Line int
+	Keys map[string]string
+}
+
+var variable = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// ReadFile reads the sections of a Fluent Bit configuration file in the
+// classic format. Files included with @INCLUDE are read relative to the
+// directory of the including file and may be glob patterns. Variables set
+// with @SET and environment variables referenced as ${NAME} in values are
+// substituted.
+func ReadFile(path string) ([]FileSection, error) {
+	r := &fileReader{vars: make(map[string]string)}
+	err := r.read(path, 0)
+	return r.sections, err
+}
+
+type fileReader struct {
+	vars     map[string]string
+	sections []FileSection
+}
+
+func (r *fileReader) read(path string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: includes nested too deeply", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// current is the index of the section the following keys belong to.
+	current := -1
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", path, n, fmt.Sprintf(format, args...))
+		}
+
+		if strings.HasPrefix(line, "@") {
+			directive, arg := splitKey(line)
+			switch strings.ToUpper(directive) {
+			case "@INCLUDE":
+				err := r.include(filepath.Dir(path), arg, depth)
+				if err != nil {
+					return errorf("%s", err)
+				}
+			case "@SET":
+				kv := strings.SplitN(arg, "=", 2)
+				if len(kv) != 2 {
+					return errorf("@SET requires KEY=VALUE")
+				}
+				r.vars[strings.TrimSpace(kv[0])] = r.expand(strings.TrimSpace(kv[1]))
+			default:
+				return errorf("unknown directive %s", directive)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return errorf("invalid section header %s", line)
+			}
+			r.sections = append(r.sections, FileSection{
+				Name: strings.TrimSpace(line[1 : len(line)-1]),
+				File: path,
+				Line: n,
+				Keys: make(map[string]string),
+			})
+			current = len(r.sections) - 1
+			continue
+		}
+
+		if current < 0 {
+			return errorf("key outside of a section")
+		}
+		key, value := splitKey(line)
+		r.sections[current].Keys[strings.ToLower(key)] = r.expand(value)
+	}
+	return scanner.Err()
+}
+
+func (r *fileReader) include(dir, pattern string, depth int) error {
+	if pattern == "" {
+		return fmt.Errorf("@INCLUDE requires a file")
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no file matches %s", pattern)
+	}
+	for _, p := range paths {
+		err := r.read(p, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expand substitutes the variables in s. Variables that are neither set nor
+// in the environment expand to an empty string, as in Fluent Bit.
+func (r *fileReader) expand(s string) string {
+	return variable.ReplaceAllStringFunc(s, func(v string) string {
+		name := v[2 : len(v)-1]
+		if value, ok := r.vars[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	})
+}
+
+// splitKey splits a line into the key before the first space or tab and
+// the rest of the line.
+func splitKey(line string) (string, string) {
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return line, ""
+	}
+	return line[:i], strings.TrimSpace(line[i:])
+}
@@ -0,0 +1,69 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/config"
+)
+
+var _ = Describe("ReadFile", func() {
+	It("reads the sections of included files", func() {
+		os.Setenv("SINK_HOST", "syslog.example.com")
+		defer os.Unsetenv("SINK_HOST")
+
+		sections, err := config.ReadFile("testdata/fluent-bit.conf")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(sections).To(HaveLen(4))
+		Expect(sections[0].Name).To(Equal("SERVICE"))
+		Expect(sections[0].Keys).To(Equal(map[string]string{
+			"flush":     "1",
+			"log_level": "info",
+		}))
+		Expect(sections[1].Name).To(Equal("INPUT"))
+		Expect(sections[1].Line).To(Equal(7))
+
+		Expect(sections[2]).To(Equal(config.FileSection{
+			Name: "OUTPUT",
+			File: filepath.Join("testdata", "outputs", "ns1.conf"),
+			Line: 2,
+			Keys: map[string]string{
+				"name":         "pivotal-syslog",
+				"match":        "*",
+				"addr":         "syslog.example.com:6514",
+				"instancename": "ns1-sink",
+				"namespace":    "ns1",
+			},
+		}))
+		Expect(sections[3].Keys["name"]).To(Equal("stdout"))
+	})
+
+	It("reports the location of errors", func() {
+		dir, err := ioutil.TempDir("", "config")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "fluent-bit.conf")
+		err = ioutil.WriteFile(path, []byte("[OUTPUT]\n    Name pivotal-syslog\n[OUTPUT\n"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = config.ReadFile(path)
+		Expect(err).To(MatchError(path + ":3: invalid section header [OUTPUT"))
+	})
+
+	It("stops files from including themselves", func() {
+		dir, err := ioutil.TempDir("", "config")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "fluent-bit.conf")
+		err = ioutil.WriteFile(path, []byte("@INCLUDE fluent-bit.conf\n"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = config.ReadFile(path)
+		Expect(err).To(MatchError(ContainSubstring("includes nested too deeply")))
+	})
+})
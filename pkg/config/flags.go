@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"strings"
+)
+
+// Sections holds the configuration keys of output plugin instances, one
+// map of lower case keys per instance, for tools configuring sinks the way
+// the plugin is configured.
+type Sections []map[string]string
+
+// RegisterFlags defines the flags -o Key=Value, which sets a key of the
+// current instance, and -sink, which starts the configuration of another
+// instance.
+func (s *Sections) RegisterFlags(fs *flag.FlagSet) {
+	fs.Var(optionFlag{s}, "o", "plugin configuration `Key=Value` of the current sink, may be repeated")
+	fs.Var(sinkFlag{s}, "sink", "start the configuration of another sink")
+}
+
+func (s *Sections) next() {
+	if n := len(*s); n == 0 || len((*s)[n-1]) != 0 {
+		*s = append(*s, make(map[string]string))
+	}
+}
+
+type optionFlag struct{ sections *Sections }
+
+func (f optionFlag) String() string { return "" }
+
+func (f optionFlag) Set(v string) error {
+	i := strings.Index(v, "=")
+	if i <= 0 {
+		return errors.New("expected Key=Value")
+	}
+	if len(*f.sections) == 0 {
+		f.sections.next()
+	}
+	keys := (*f.sections)[len(*f.sections)-1]
+	keys[strings.ToLower(strings.TrimSpace(v[:i]))] = v[i+1:]
+	return nil
+}
+
+type sinkFlag struct{ sections *Sections }
+
+func (f sinkFlag) String() string   { return "" }
+func (f sinkFlag) IsBoolFlag() bool { return true }
+
+func (f sinkFlag) Set(string) error {
+	f.sections.next()
+	return nil
+}
@@ -0,0 +1,42 @@
+package config_test
+
+import (
+	"flag"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/config"
+)
+
+var _ = Describe("Sections", func() {
+	parse := func(args ...string) (config.Sections, error) {
+		var sections config.Sections
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		sections.RegisterFlags(fs)
+		return sections, fs.Parse(args)
+	}
+
+	It("collects the keys of each sink", func() {
+		sections, err := parse(
+			"-sink",
+			"-o", "Addr=localhost:6514",
+			"-o", `TLSConfig={"root_ca":"ca.pem"}`,
+			"-sink",
+			"-o", "Addr=localhost:6515",
+			"-o", "Cluster=true",
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sections).To(Equal(config.Sections{
+			{"addr": "localhost:6514", "tlsconfig": `{"root_ca":"ca.pem"}`},
+			{"addr": "localhost:6515", "cluster": "true"},
+		}))
+	})
+
+	It("requires keys and values", func() {
+		_, err := parse("-o", "localhost:6514")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+// PluginName is the name the plugin registers with Fluent Bit, which output
+// sections select it by.
+const PluginName = "pivotal-syslog"
+
+// Keys that Fluent Bit handles for every output plugin.
+var fluentBitKeys = map[string]bool{
+	"name":                     true,
+	"match":                    true,
+	"match_regex":              true,
+	"alias":                    true,
+	"retry_limit":              true,
+	"workers":                  true,
+	"log_level":                true,
+	"storage.total_limit_size": true,
+}
+
+// Report is the result of validating the configuration of an output plugin
+// instance.
+type Report struct {
+	// Config is nil if the keys could not be parsed.
+	Config   *Config
+	Errors   []string
+	Warnings []string
+}
+
+// Validate checks the configuration keys of an output plugin instance, with
+// lower case names, beyond what Parse checks when Fluent Bit starts the
+// plugin. It loads the root CA, checks the syntax of the addresses and
+// warns about keys that are not used and settings that are likely
+// mistakes. The keys that are valid are checked even if others are not.
+func Validate(keys map[string]string) *Report {
+	cfg, problems := parse(func(key string) string {
+		return keys[key]
+	})
+	r := &Report{Errors: problems}
+	if len(problems) == 0 {
+		r.Config = cfg
+	}
+
+	known := pluginKeys()
+	var unknown []string
+	for k := range keys {
+		if !known[k] && !fluentBitKeys[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("key %s is not used by the plugin", k))
+	}
+
+	if c := keys["cluster"]; c != "" && !strings.EqualFold(c, "true") && !strings.EqualFold(c, "false") {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Cluster %q is neither true nor false, the sink is not a cluster sink", c))
+	}
+	s := cfg.Sink
+	if !cfg.Cluster && s.Namespace == "" {
+		r.Warnings = append(r.Warnings, "Namespace is not set, the sink only receives records without a namespace")
+	}
+	if s.TLS != nil {
+		if _, err := s.TLS.ClientConfig(""); err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("unable to load TLS config: %s", err))
+		}
+		if s.TLS.InsecureSkipVerify {
+			r.Warnings = append(r.Warnings, "TLS certificates are not verified")
+		}
+	}
+
+	addrs := []struct {
+		key   string
+		addrs []string
+	}{
+		{"Addr", []string{s.Addr}},
+		{"FailoverAddrs", s.FailoverAddrs},
+		{"BalanceAddrs", s.BalanceAddrs},
+		{"BalanceHost", []string{s.BalanceHost}},
+	}
+	for _, a := range addrs {
+		for _, addr := range a.addrs {
+			if addr == "" {
+				continue
+			}
+			if err := checkAddr(addr); err != nil {
+				r.Errors = append(r.Errors, fmt.Sprintf("invalid %s %q: %s", a.key, syslog.RedactAddr(addr), err))
+			}
+		}
+	}
+	if strings.HasPrefix(s.Addr, "https://") {
+		unsupported := []struct {
+			key string
+			set bool
+		}{
+			{"FailoverAddrs", len(s.FailoverAddrs) != 0},
+			{"BalanceAddrs", len(s.BalanceAddrs) != 0},
+			{"BalanceHost", s.BalanceHost != ""},
+			{"BalanceSRV", s.BalanceSRV != ""},
+			{"SRV", s.SRV != ""},
+			{"Protocol", s.Protocol == syslog.ProtocolRELP},
+			{"WriteBufferSize", s.WriteBufferSize != 0},
+		}
+		for _, u := range unsupported {
+			if u.set {
+				r.Errors = append(r.Errors, fmt.Sprintf("%s is not supported for HTTPS drains", u.key))
+			}
+		}
+	}
+	return r
+}
+
+// pluginKeys returns the keys Parse reads.
+func pluginKeys() map[string]bool {
+	keys := make(map[string]bool)
+	_, _ = parse(func(key string) string {
+		keys[key] = true
+		return ""
+	})
+	return keys
+}
+
+// checkAddr checks that addr is a host and port, an HTTPS URL or the path
+// of a unix socket.
+func checkAddr(addr string) error {
+	switch {
+	case strings.HasPrefix(addr, "http://"):
+		return errors.New("plain HTTP drains are not supported, use https://")
+	case strings.HasPrefix(addr, "https://"):
+		u, err := url.Parse(addr)
+		if err != nil {
+			return err
+		}
+		if u.Host == "" {
+			return errors.New("missing host")
+		}
+		return nil
+	case strings.HasPrefix(addr, "unix://"), strings.HasPrefix(addr, "unixgram://"):
+		if strings.SplitN(addr, "://", 2)[1] == "" {
+			return errors.New("missing socket path")
+		}
+		return nil
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if port == "" {
+		return errors.New("missing port")
+	}
+	return nil
+}
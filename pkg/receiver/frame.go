@@ -0,0 +1,134 @@
+package receiver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Framing is how messages are delimited on stream transports.
+type Framing string
+
+// Framings of RFC 6587. FramingAuto detects the framing of every frame
+// from its first byte, which is a digit for octet counted frames and the
+// '<' of the PRI for newline delimited ones.
+const (
+	FramingAuto         Framing = "auto"
+	FramingOctetCounted Framing = "octet-counted"
+	FramingNewline      Framing = "newline"
+)
+
+// DefaultMaxFrameSize is the maximum size of frames unless configured
+// otherwise.
+const DefaultMaxFrameSize = 1 << 20
+
+// ParseFraming parses the name of a framing. An empty name is FramingAuto.
+func ParseFraming(s string) (Framing, error) {
+	switch f := Framing(s); f {
+	case "":
+		return FramingAuto, nil
+	case FramingAuto, FramingOctetCounted, FramingNewline:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown framing %q", s)
+}
+
+// FrameReader reads the frames of a stream.
+type FrameReader struct {
+	r       *bufio.Reader
+	framing Framing
+	maxSize int
+}
+
+// NewFrameReader returns a FrameReader reading frames of at most maxSize
+// bytes from r. A maxSize of zero or less uses DefaultMaxFrameSize.
+func NewFrameReader(r io.Reader, framing Framing, maxSize int) *FrameReader {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	return &FrameReader{
+		r:       bufio.NewReader(r),
+		framing: framing,
+		maxSize: maxSize,
+	}
+}
+
+// Next returns the next frame without its framing. It returns io.EOF if
+// the stream ended between frames. Frames that can not be read leave the
+// stream in an unknown state.
+func (f *FrameReader) Next() ([]byte, error) {
+	framing := f.framing
+	if framing == FramingAuto {
+		b, err := f.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		framing = FramingNewline
+		if b[0] >= '0' && b[0] <= '9' {
+			framing = FramingOctetCounted
+		}
+	}
+
+	if framing == FramingNewline {
+		return f.readLine()
+	}
+	return f.readOctetCounted()
+}
+
+// readOctetCounted reads a frame of the form MSG-LEN SP SYSLOG-MSG where
+// MSG-LEN is a nonzero number without leading zeros.
+func (f *FrameReader) readOctetCounted() ([]byte, error) {
+	var n int
+	for i := 0; ; i++ {
+		c, err := f.r.ReadByte()
+		if err == io.EOF && i != 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c == ' ' && i != 0 {
+			break
+		}
+		if c < '0' || c > '9' || (i == 0 && c == '0') {
+			return nil, fmt.Errorf("invalid octet count: unexpected %q", c)
+		}
+		n = n*10 + int(c-'0')
+		if n > f.maxSize {
+			return nil, fmt.Errorf("frame exceeds %d bytes", f.maxSize)
+		}
+	}
+
+	frame := make([]byte, n)
+	_, err := io.ReadFull(f.r, frame)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// readLine reads a frame terminated by LF.
+func (f *FrameReader) readLine() ([]byte, error) {
+	var frame []byte
+	for {
+		line, err := f.r.ReadSlice('\n')
+		frame = append(frame, line...)
+		if len(frame) > f.maxSize+1 {
+			return nil, fmt.Errorf("frame exceeds %d bytes", f.maxSize)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(frame) != 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimSuffix(frame, []byte("\n")), nil
+	}
+}
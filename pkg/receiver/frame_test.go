@@ -0,0 +1,81 @@
+package receiver_test
+
+import (
+	"io"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/receiver"
+)
+
+var _ = Describe("FrameReader", func() {
+	frames := func(r *receiver.FrameReader) []string {
+		var frames []string
+		for {
+			f, err := r.Next()
+			if err == io.EOF {
+				return frames
+			}
+			Expect(err).ToNot(HaveOccurred())
+			frames = append(frames, string(f))
+		}
+	}
+
+	It("reads octet counted frames", func() {
+		r := receiver.NewFrameReader(strings.NewReader("6 <14>1\n3 a b"), receiver.FramingOctetCounted, 0)
+		Expect(frames(r)).To(Equal([]string{"<14>1\n", "a b"}))
+	})
+
+	It("reads newline delimited frames", func() {
+		r := receiver.NewFrameReader(strings.NewReader("<14>1 a\n<14>1 b\n"), receiver.FramingNewline, 0)
+		Expect(frames(r)).To(Equal([]string{"<14>1 a", "<14>1 b"}))
+	})
+
+	It("detects the framing of each frame", func() {
+		r := receiver.NewFrameReader(strings.NewReader("7 <14>1 a<14>1 b\n7 <14>1 c"), receiver.FramingAuto, 0)
+		Expect(frames(r)).To(Equal([]string{"<14>1 a", "<14>1 b", "<14>1 c"}))
+	})
+
+	It("rejects invalid octet counts", func() {
+		for _, s := range []string{"05 hello", "x hello", " hello"} {
+			r := receiver.NewFrameReader(strings.NewReader(s), receiver.FramingOctetCounted, 0)
+			_, err := r.Next()
+			Expect(err).To(MatchError(ContainSubstring("invalid octet count")), s)
+		}
+	})
+
+	It("rejects frames exceeding the maximum size", func() {
+		r := receiver.NewFrameReader(strings.NewReader("11 hello world"), receiver.FramingOctetCounted, 10)
+		_, err := r.Next()
+		Expect(err).To(MatchError("frame exceeds 10 bytes"))
+
+		r = receiver.NewFrameReader(strings.NewReader("hello world\n"), receiver.FramingNewline, 10)
+		_, err = r.Next()
+		Expect(err).To(MatchError("frame exceeds 10 bytes"))
+	})
+
+	It("reports truncated frames", func() {
+		r := receiver.NewFrameReader(strings.NewReader("10 hello"), receiver.FramingOctetCounted, 0)
+		_, err := r.Next()
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+
+		r = receiver.NewFrameReader(strings.NewReader("hello"), receiver.FramingNewline, 0)
+		_, err = r.Next()
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+	})
+
+	It("parses framing names", func() {
+		f, err := receiver.ParseFraming("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f).To(Equal(receiver.FramingAuto))
+
+		f, err = receiver.ParseFraming("newline")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f).To(Equal(receiver.FramingNewline))
+
+		_, err = receiver.ParseFraming("unknown")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,196 @@
+// Package receiver receives syslog messages over TCP, TLS and UDP and
+// validates them against RFC 5424, for testing senders end to end.
+package receiver
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+// Record is a received frame along with the message parsed from it.
+type Record struct {
+	ReceivedAt time.Time `json:"received_at"`
+	Transport  string    `json:"transport"`
+	RemoteAddr string    `json:"remote_addr"`
+	Valid      bool      `json:"valid"`
+	// Errors holds why the frame is invalid, or why the connection was
+	// closed if Message and Frame are not set.
+	Errors  []string `json:"errors,omitempty"`
+	Message *Message `json:"message,omitempty"`
+	// Frame is the raw frame of invalid messages.
+	Frame string `json:"frame,omitempty"`
+}
+
+// Message is a parsed syslog message.
+type Message struct {
+	Priority       int              `json:"priority"`
+	Facility       int              `json:"facility"`
+	Severity       int              `json:"severity"`
+	Timestamp      *time.Time       `json:"timestamp"`
+	Hostname       string           `json:"hostname"`
+	AppName        string           `json:"app_name"`
+	ProcessID      string           `json:"proc_id"`
+	MessageID      string           `json:"msg_id"`
+	StructuredData []StructuredData `json:"structured_data"`
+	Message        string           `json:"msg"`
+}
+
+// StructuredData is an SD-ELEMENT of a message.
+type StructuredData struct {
+	ID         string    `json:"id"`
+	Parameters []SDParam `json:"params"`
+}
+
+// SDParam is an SD-PARAM of an SD-ELEMENT.
+type SDParam struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func newMessage(m *rfc5424.Message) *Message {
+	msg := &Message{
+		Priority:       int(m.Priority),
+		Facility:       int(m.Priority) >> 3,
+		Severity:       int(m.Priority) & 0x07,
+		Hostname:       m.Hostname,
+		AppName:        m.AppName,
+		ProcessID:      m.ProcessID,
+		MessageID:      m.MessageID,
+		StructuredData: []StructuredData{},
+		Message:        string(m.Message),
+	}
+	if !m.Timestamp.IsZero() {
+		ts := m.Timestamp
+		msg.Timestamp = &ts
+	}
+	for _, sd := range m.StructuredData {
+		e := StructuredData{
+			ID:         sd.ID,
+			Parameters: []SDParam{},
+		}
+		for _, p := range sd.Parameters {
+			e.Parameters = append(e.Parameters, SDParam{Name: p.Name, Value: p.Value})
+		}
+		msg.StructuredData = append(msg.StructuredData, e)
+	}
+	return msg
+}
+
+// Receiver validates the frames it receives and hands them to Handle.
+type Receiver struct {
+	// Framing is the framing of stream transports and defaults to
+	// FramingAuto. Every datagram is a single message.
+	Framing Framing
+	// MaxFrameSize defaults to DefaultMaxFrameSize.
+	MaxFrameSize int
+	// Handle is called with each record. Calls are serialized.
+	Handle func(Record)
+
+	mu sync.Mutex
+}
+
+// Serve accepts connections on l and reads frames from them until l is
+// closed. Listeners returned by tls.NewListener receive TLS connections.
+func (r *Receiver) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go r.serveConn(conn)
+	}
+}
+
+func (r *Receiver) serveConn(conn net.Conn) {
+	defer conn.Close()
+	transport := "tcp"
+	if tc, ok := conn.(*tls.Conn); ok {
+		transport = "tls"
+		if err := tc.Handshake(); err != nil {
+			r.handle(Record{
+				ReceivedAt: time.Now(),
+				Transport:  transport,
+				RemoteAddr: conn.RemoteAddr().String(),
+				Errors:     []string{"tls handshake: " + err.Error()},
+			})
+			return
+		}
+	}
+
+	framing := r.Framing
+	if framing == "" {
+		framing = FramingAuto
+	}
+	frames := NewFrameReader(conn, framing, r.MaxFrameSize)
+	for {
+		frame, err := frames.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			r.handle(Record{
+				ReceivedAt: time.Now(),
+				Transport:  transport,
+				RemoteAddr: conn.RemoteAddr().String(),
+				Errors:     []string{"reading frame: " + err.Error()},
+			})
+			return
+		}
+		r.handle(r.record(frame, transport, conn.RemoteAddr()))
+	}
+}
+
+// ServePacket reads datagrams from pc until it is closed.
+func (r *Receiver) ServePacket(pc net.PacketConn) error {
+	size := r.MaxFrameSize
+	if size <= 0 {
+		size = DefaultMaxFrameSize
+	}
+	buf := make([]byte, size)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		frame := make([]byte, n)
+		copy(frame, buf[:n])
+		r.handle(r.record(frame, "udp", addr))
+	}
+}
+
+func (r *Receiver) record(frame []byte, transport string, addr net.Addr) Record {
+	rec := Record{
+		ReceivedAt: time.Now(),
+		Transport:  transport,
+		RemoteAddr: addr.String(),
+		Valid:      true,
+	}
+	msg, err := Validate(frame)
+	if msg != nil {
+		rec.Message = newMessage(msg)
+	}
+	if err != nil {
+		rec.Valid = false
+		rec.Frame = string(frame)
+		if ve, ok := err.(*ValidationError); ok {
+			rec.Errors = ve.Violations
+		} else {
+			rec.Errors = []string{err.Error()}
+		}
+	}
+	return rec
+}
+
+func (r *Receiver) handle(rec Record) {
+	if r.Handle == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Handle(rec)
+}
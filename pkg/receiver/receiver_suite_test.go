@@ -0,0 +1,16 @@
+package receiver_test
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestReceiver(t *testing.T) {
+	RegisterFailHandler(Fail)
+	log.SetOutput(ioutil.Discard)
+	RunSpecs(t, "Receiver Suite")
+}
@@ -0,0 +1,140 @@
+package receiver_test
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/receiver"
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Receiver", func() {
+	var (
+		mu      sync.Mutex
+		records []receiver.Record
+		r       *receiver.Receiver
+	)
+
+	BeforeEach(func() {
+		records = nil
+		r = &receiver.Receiver{
+			Handle: func(rec receiver.Record) {
+				mu.Lock()
+				defer mu.Unlock()
+				records = append(records, rec)
+			},
+		}
+	})
+
+	received := func() []receiver.Record {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receiver.Record(nil), records...)
+	}
+
+	record := map[interface{}]interface{}{
+		"log": []byte("some-log"),
+		"kubernetes": map[interface{}]interface{}{
+			"namespace_name": []byte("ns1"),
+			"pod_name":       []byte("pod-name"),
+			"container_name": []byte("container-name"),
+		},
+	}
+
+	It("receives the messages of sinks", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+		go func() {
+			_ = r.Serve(l)
+		}()
+
+		out := syslog.NewOut(nil, []*syslog.Sink{{Addr: l.Addr().String()}})
+		out.Write(record, time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record, time.Unix(0, 0).UTC(), "pod.log")
+
+		Eventually(received).Should(HaveLen(2))
+		rec := received()[0]
+		Expect(rec.Transport).To(Equal("tcp"))
+		Expect(rec.Valid).To(BeTrue())
+		Expect(rec.Errors).To(BeEmpty())
+		Expect(rec.Message.AppName).To(Equal("pod.log/ns1/pod-name/container-name"))
+		Expect(rec.Message.Severity).To(Equal(6))
+		Expect(rec.Message.Facility).To(Equal(1))
+		Expect(rec.Message.StructuredData[0].ID).To(Equal("kubernetes@47450"))
+		Expect(rec.Message.Message).To(Equal("some-log\n"))
+	})
+
+	It("receives messages over TLS", func() {
+		cert, err := tls.LoadX509KeyPair("../syslog/testdata/server.crt", "../syslog/testdata/server.key")
+		Expect(err).ToNot(HaveOccurred())
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+		go func() {
+			_ = r.Serve(tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}}))
+		}()
+
+		out := syslog.NewOut(nil, []*syslog.Sink{{
+			Addr: l.Addr().String(),
+			TLS:  &syslog.TLS{InsecureSkipVerify: true},
+		}})
+		out.Write(record, time.Unix(0, 0).UTC(), "pod.log")
+
+		Eventually(received).Should(HaveLen(1))
+		Expect(received()[0].Transport).To(Equal("tls"))
+		Expect(received()[0].Valid).To(BeTrue())
+	})
+
+	It("receives datagrams", func() {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer pc.Close()
+		go func() {
+			_ = r.ServePacket(pc)
+		}()
+
+		conn, err := net.Dial("udp", pc.LocalAddr().String())
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		_, err = conn.Write([]byte(`<14>1 - host app - - - some-log`))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = conn.Write([]byte(`<192>1 - host app - - - some-log`))
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(received).Should(HaveLen(2))
+		Expect(received()[0].Transport).To(Equal("udp"))
+		Expect(received()[0].Valid).To(BeTrue())
+		Expect(received()[0].Message.Hostname).To(Equal("host"))
+		Expect(received()[1].Valid).To(BeFalse())
+		Expect(received()[1].Frame).To(Equal(`<192>1 - host app - - - some-log`))
+		Expect(received()[1].Errors).To(ConsistOf(ContainSubstring("PRI")))
+	})
+
+	It("reports frames that can not be read", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+		r.Framing = receiver.FramingOctetCounted
+		go func() {
+			_ = r.Serve(l)
+		}()
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		_, err = conn.Write([]byte("<14>1 - host app - - - some-log\n"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(received).Should(HaveLen(1))
+		rec := received()[0]
+		Expect(rec.Valid).To(BeFalse())
+		Expect(rec.Message).To(BeNil())
+		Expect(rec.Errors).To(ConsistOf(ContainSubstring("invalid octet count")))
+	})
+})
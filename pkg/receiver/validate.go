@@ -0,0 +1,162 @@
+package receiver
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+// ValidationError lists how a frame violates RFC 5424.
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid syslog message: " + strings.Join(e.Violations, "; ")
+}
+
+var timestampFormat = regexp.MustCompile(
+	`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d{1,6})?(Z|[+-]\d{2}:\d{2})$`,
+)
+
+// Registered SD-IDs that are not of the form name@<private enterprise
+// number>.
+var ianaSDIDs = map[string]bool{
+	"timeQuality": true,
+	"origin":      true,
+	"meta":        true,
+}
+
+var bom = []byte("\xef\xbb\xbf")
+
+// Validate parses a frame with rfc5424.Message.UnmarshalBinary and checks
+// it against the grammar of RFC 5424 more strictly than the parser does:
+// the range of PRI, the length and characters of the header fields, SD-IDs
+// and parameter names, the precision of the timestamp, the uniqueness of
+// SD-IDs and the encoding of parameter values and UTF-8 messages. A
+// *ValidationError is returned along with the parsed message if the frame
+// could be parsed but is not valid.
+func Validate(frame []byte) (*rfc5424.Message, error) {
+	var v []string
+	fields := bytes.SplitN(frame, []byte(" "), 7)
+	nilTimestamp := false
+	if len(fields) == 7 {
+		v = append(v, validatePri(fields[0])...)
+		if ts := fields[1]; string(ts) == "-" {
+			nilTimestamp = true
+		} else if !timestampFormat.Match(ts) {
+			v = append(v, fmt.Sprintf("TIMESTAMP %q is not an RFC 3339 timestamp with at most microsecond precision", ts))
+		}
+		headers := []struct {
+			name  string
+			value []byte
+			max   int
+		}{
+			{"HOSTNAME", fields[2], 255},
+			{"APP-NAME", fields[3], 48},
+			{"PROCID", fields[4], 128},
+			{"MSGID", fields[5], 32},
+		}
+		for _, h := range headers {
+			if !printUSASCII(h.value, h.max) {
+				v = append(v, fmt.Sprintf("%s must be - or 1 to %d printable US-ASCII characters", h.name, h.max))
+			}
+		}
+	}
+
+	var msg rfc5424.Message
+	parsed := frame
+	if nilTimestamp {
+		// The parser does not accept the NILVALUE as timestamp.
+		parsed = bytes.Join([][]byte{fields[0], []byte("1970-01-01T00:00:00Z"), bytes.Join(fields[2:], []byte(" "))}, []byte(" "))
+	}
+	if err := msg.UnmarshalBinary(parsed); err != nil {
+		return nil, err
+	}
+	if nilTimestamp {
+		msg.Timestamp = time.Time{}
+	}
+
+	ids := make(map[string]bool, len(msg.StructuredData))
+	for _, sd := range msg.StructuredData {
+		if !sdName(sd.ID) {
+			v = append(v, fmt.Sprintf("SD-ID %q must be 1 to 32 printable US-ASCII characters except '=', ' ', ']' and '\"'", sd.ID))
+		} else if !strings.Contains(sd.ID, "@") && !ianaSDIDs[sd.ID] {
+			v = append(v, fmt.Sprintf("SD-ID %q is neither registered nor of the form name@number", sd.ID))
+		}
+		if ids[sd.ID] {
+			v = append(v, fmt.Sprintf("SD-ID %q occurs more than once", sd.ID))
+		}
+		ids[sd.ID] = true
+		for _, p := range sd.Parameters {
+			if !sdName(p.Name) {
+				v = append(v, fmt.Sprintf("PARAM-NAME %q of %s must be 1 to 32 printable US-ASCII characters except '=', ' ', ']' and '\"'", p.Name, sd.ID))
+			}
+			if !utf8.ValidString(p.Value) {
+				v = append(v, fmt.Sprintf("PARAM-VALUE of %s %s is not valid UTF-8", sd.ID, p.Name))
+			}
+		}
+	}
+	if bytes.HasPrefix(msg.Message, bom) && !utf8.Valid(msg.Message[len(bom):]) {
+		v = append(v, "MSG starts with a BOM but is not valid UTF-8")
+	}
+
+	if len(v) != 0 {
+		return &msg, &ValidationError{Violations: v}
+	}
+	return &msg, nil
+}
+
+// validatePri checks the PRI of PRI VERSION to be a number between 0 and
+// 191 without leading zeros in angle brackets. The parser checks the
+// VERSION.
+func validatePri(b []byte) []string {
+	end := bytes.IndexByte(b, '>')
+	if len(b) == 0 || b[0] != '<' || end < 0 {
+		// The parser reports it.
+		return nil
+	}
+
+	var v []string
+	pri := b[1:end]
+	n := 0
+	valid := len(pri) >= 1 && len(pri) <= 3 && (len(pri) == 1 || pri[0] != '0')
+	for _, c := range pri {
+		if c < '0' || c > '9' {
+			valid = false
+			break
+		}
+		n = n*10 + int(c-'0')
+	}
+	if !valid || n > 191 {
+		v = append(v, fmt.Sprintf("PRI %q must be a number from 0 to 191 without leading zeros", pri))
+	}
+	return v
+}
+
+// printUSASCII reports whether b is the NILVALUE or 1 to max characters
+// from '!' to '~'.
+func printUSASCII(b []byte, max int) bool {
+	if len(b) == 0 || len(b) > max {
+		return false
+	}
+	for _, c := range b {
+		if c < 33 || c > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+// sdName reports whether s is a valid SD-NAME.
+func sdName(s string) bool {
+	if !printUSASCII([]byte(s), 32) {
+		return false
+	}
+	return !strings.ContainsAny(s, `= ]"`)
+}
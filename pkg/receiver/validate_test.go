@@ -0,0 +1,56 @@
+package receiver_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/receiver"
+)
+
+var _ = Describe("Validate", func() {
+	It("accepts valid messages", func() {
+		msg, err := receiver.Validate([]byte(
+			`<14>1 1970-01-01T00:00:00.123456+00:00 host pod.log/ns1/pod/c - - [kubernetes@47450 namespace_name="ns1" object_name="pod"] some-log` + "\n",
+		))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg.Hostname).To(Equal("host"))
+		Expect(msg.StructuredData[0].Parameters[1].Value).To(Equal("pod"))
+		Expect(string(msg.Message)).To(Equal("some-log\n"))
+	})
+
+	It("accepts the nil timestamp", func() {
+		msg, err := receiver.Validate([]byte(`<14>1 - host app - - - some-log`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg.Timestamp).To(Equal(time.Time{}))
+		Expect(msg.AppName).To(Equal("app"))
+	})
+
+	It("returns errors of the parser", func() {
+		_, err := receiver.Validate([]byte(`14>1 - host app - - - some-log`))
+		Expect(err).To(HaveOccurred())
+		_, ok := err.(*receiver.ValidationError)
+		Expect(ok).To(BeFalse())
+	})
+
+	table.DescribeTable("rejects messages violating RFC 5424",
+		func(frame, violation string) {
+			msg, err := receiver.Validate([]byte(frame))
+			Expect(msg).ToNot(BeNil())
+			Expect(err).To(BeAssignableToTypeOf(&receiver.ValidationError{}))
+			Expect(err.(*receiver.ValidationError).Violations).To(ContainElement(ContainSubstring(violation)))
+		},
+		table.Entry("PRI out of range", `<192>1 - host app - - -`, "PRI"),
+		table.Entry("PRI with leading zeros", `<014>1 - host app - - -`, "PRI"),
+		table.Entry("timestamp precision", `<14>1 1970-01-01T00:00:00.1234567Z host app - - -`, "TIMESTAMP"),
+		table.Entry("long APP-NAME", `<14>1 - host `+strings.Repeat("a", 49)+` - - -`, "APP-NAME"),
+		table.Entry("non ASCII HOSTNAME", `<14>1 - höst app - - -`, "HOSTNAME"),
+		table.Entry("unregistered SD-ID", `<14>1 - host app - - [kubernetes a="b"]`, "SD-ID"),
+		table.Entry("duplicate SD-ID", `<14>1 - host app - - [a@1][a@1]`, "more than once"),
+		table.Entry("PARAM-NAME", `<14>1 - host app - - [a@1 "a"="b"]`, "PARAM-NAME"),
+		table.Entry("invalid UTF-8 after BOM", "<14>1 - host app - - - \xef\xbb\xbf\xff", "MSG"),
+	)
+})
@@ -0,0 +1,355 @@
+package syslog
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BalancePolicy determines how a sink distributes messages across the
+// connections of its balancing pool.
+type BalancePolicy string
+
+const (
+	// BalanceRoundRobin sends each message to the next connection in turn.
+	BalanceRoundRobin BalancePolicy = "round-robin"
+	// BalanceHashPod sends all messages of a pod to the same connection,
+	// which preserves their order.
+	BalanceHashPod BalancePolicy = "hash-pod"
+)
+
+// virtualNodes is the number of points each address has on the hash ring.
+const virtualNodes = 128
+
+// emptyPoolRetryInterval limits how often a pool without members resolves
+// its endpoints again when messages arrive.
+const emptyPoolRetryInterval = time.Second
+
+// ParseBalancePolicy returns the BalancePolicy for the given configuration
+// value. An empty value results in BalanceRoundRobin.
+func ParseBalancePolicy(s string) (BalancePolicy, error) {
+	switch p := BalancePolicy(s); p {
+	case "":
+		return BalanceRoundRobin, nil
+	case BalanceRoundRobin, BalanceHashPod:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown balance policy %q", s)
+}
+
+// pool distributes the messages of a sink across member sinks that each
+// have their own queue and connection to one address.
+type pool struct {
+	policy    BalancePolicy
+	newMember func(endpoint) *Sink
+	resolve   func() ([]endpoint, error)
+	next      uint64
+
+	resolveMu   sync.Mutex
+	lastResolve time.Time
+
+	mu      sync.RWMutex
+	members []*Sink
+	ring    *hashRing
+	// retired members no longer receive messages and are kept until they
+	// have exited. Their counters are then added to retiredTotals.
+	retired       []*Sink
+	retiredTotals Sink
+}
+
+// newPool returns a pool with a member sink for each endpoint. Members are
+// configured like s and use a queue from newQueue.
+func (o *Out) newPool(s *Sink, eps []endpoint, newQueue func() queue) *pool {
+	p := &pool{
+		policy: s.BalancePolicy,
+		newMember: func(ep endpoint) *Sink {
+			m := &Sink{
+				Addr:           ep.addr,
+				Name:           s.Name,
+				Namespace:      s.Namespace,
+				TLS:            s.TLS,
+				Protocol:       s.Protocol,
+				RELPWindow:     s.RELPWindow,
+				MaxMessageSize: s.MaxMessageSize,
+				SizePolicy:     s.SizePolicy,
+				Retry:          s.Retry,
+				CircuitBreaker: s.CircuitBreaker,
+
+				MaxConnectionAge: s.MaxConnectionAge,
+				IdleTimeout:      s.IdleTimeout,
+				KeepAlive:        s.KeepAlive,
+				WriteBufferSize:  s.WriteBufferSize,
+				WriteLinger:      s.WriteLinger,
+
+				messages:   newQueue(),
+				redactor:   s.redactor,
+				serverName: ep.host,
+			}
+			o.startSink(m, []string{ep.addr}, nil)
+			return m
+		},
+		resolve: func() ([]endpoint, error) {
+			return o.balanceEndpoints(s)
+		},
+	}
+	p.update(eps)
+	return p
+}
+
+// update makes the pool consist of a member for each endpoint. Members of
+// endpoints that are gone stop receiving messages and exit once they have
+// written the messages already queued.
+func (p *pool) update(eps []endpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.releaseRetired()
+	current := make(map[string]*Sink, len(p.members))
+	for _, m := range p.members {
+		current[m.Addr] = m
+	}
+
+	var (
+		members []*Sink
+		addrs   []string
+		added   int
+	)
+	seen := make(map[string]bool, len(eps))
+	for _, ep := range eps {
+		if seen[ep.addr] {
+			continue
+		}
+		seen[ep.addr] = true
+
+		m, ok := current[ep.addr]
+		if ok {
+			delete(current, ep.addr)
+		} else {
+			m = p.newMember(ep)
+			added++
+		}
+		members = append(members, m)
+		addrs = append(addrs, ep.addr)
+	}
+	if added == 0 && len(current) == 0 {
+		return
+	}
+
+	for _, m := range current {
+		m.messages.close()
+		p.retired = append(p.retired, m)
+	}
+	if p.members != nil {
+		log.Printf("[out_syslog] Sink pool changed to %s\n", strings.Join(addrs, ", "))
+	}
+	p.members = members
+	p.ring = newHashRing(addrs)
+}
+
+// releaseRetired adds the counters of retired members that have exited to
+// the pool's totals and forgets them. It must be called with p.mu held.
+func (p *pool) releaseRetired() {
+	retired := p.retired[:0]
+	for _, m := range p.retired {
+		select {
+		case <-m.exited:
+		default:
+			retired = append(retired, m)
+			continue
+		}
+		t := &p.retiredTotals
+		t.messagesSent += atomic.LoadInt64(&m.messagesSent)
+		t.messagesDropped += atomic.LoadInt64(&m.messagesDropped)
+		t.messagesOversized += atomic.LoadInt64(&m.messagesOversized)
+		t.messagesRetried += atomic.LoadInt64(&m.messagesRetried)
+		t.messagesResent += atomic.LoadInt64(&m.messagesResent)
+	}
+	for i := len(retired); i < len(p.retired); i++ {
+		p.retired[i] = nil
+	}
+	p.retired = retired
+}
+
+// enqueue pushes msg onto the queue of the member responsible for src. A
+// pool without members, for example because resolving failed at startup,
+// resolves its endpoints again first. It returns false if the pool still
+// has no members.
+func (p *pool) enqueue(msg io.WriterTo, src source) bool {
+	if p.push(msg, src) {
+		return true
+	}
+	p.resolveEmpty()
+	return p.push(msg, src)
+}
+
+// resolveEmpty updates a pool without members with its resolved endpoints,
+// at most once per emptyPoolRetryInterval.
+func (p *pool) resolveEmpty() {
+	p.resolveMu.Lock()
+	defer p.resolveMu.Unlock()
+
+	p.mu.RLock()
+	empty := len(p.members) == 0
+	p.mu.RUnlock()
+	if !empty || time.Since(p.lastResolve) < emptyPoolRetryInterval {
+		return
+	}
+	p.lastResolve = time.Now()
+
+	eps, err := p.resolve()
+	if err != nil {
+		log.Printf("[out_syslog] Unable to resolve addresses of sink pool: %s\n", err)
+	}
+	p.update(eps)
+}
+
+// push pushes msg onto the queue of the member responsible for src. It
+// returns false if the pool has no members.
+func (p *pool) push(msg io.WriterTo, src source) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.members) == 0 {
+		return false
+	}
+	var m *Sink
+	if p.policy == BalanceHashPod {
+		m = p.members[p.ring.get(src.namespace+"/"+src.pod)]
+	} else {
+		n := atomic.AddUint64(&p.next, 1)
+		m = p.members[(n-1)%uint64(len(p.members))]
+	}
+	m.enqueue(msg, src)
+	return true
+}
+
+// count returns the sum of the given counter over all current and retired
+// members.
+func (p *pool) count(counter func(*Sink) *int64) int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	n := *counter(&p.retiredTotals)
+	for _, m := range p.members {
+		n += atomic.LoadInt64(counter(m))
+	}
+	for _, m := range p.retired {
+		n += atomic.LoadInt64(counter(m))
+	}
+	return n
+}
+
+// idle reports whether all current and retired members are idle.
+func (p *pool) idle() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, m := range p.members {
+		if !m.idle() {
+			return false
+		}
+	}
+	for _, m := range p.retired {
+		if !m.idle() {
+			return false
+		}
+	}
+	return true
+}
+
+// state summarizes the state of the members in st and lists it per member.
+func (p *pool) state(st *SinkState) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, m := range p.members {
+		ms := m.state()
+		if ms.LastSuccessfulSend.After(st.LastSuccessfulSend) {
+			st.LastSuccessfulSend = ms.LastSuccessfulSend
+		}
+		if ms.Error != nil && (st.Error == nil || ms.Error.Timestamp.After(st.Error.Timestamp)) {
+			st.Error = ms.Error
+		}
+		for ns, d := range ms.NamespaceDrops {
+			if st.NamespaceDrops == nil {
+				st.NamespaceDrops = make(map[string]int64)
+			}
+			st.NamespaceDrops[ns] += d
+		}
+		st.Pool = append(st.Pool, SinkState{
+			LastSuccessfulSend: ms.LastSuccessfulSend,
+			Error:              ms.Error,
+			Backoff:            ms.Backoff,
+			CircuitBreaker:     ms.CircuitBreaker,
+			ActiveAddr:         ms.ActiveAddr,
+			Connected:          ms.Connected,
+			Unacked:            ms.Unacked,
+		})
+	}
+}
+
+// hashRing maps keys to addresses by consistent hashing so that few keys
+// move when addresses are added or removed.
+type hashRing struct {
+	points  []uint32
+	indexes map[uint32]int
+}
+
+func newHashRing(addrs []string) *hashRing {
+	r := &hashRing{
+		indexes: make(map[uint32]int),
+	}
+	for i, addr := range addrs {
+		for v := 0; v < virtualNodes; v++ {
+			h := hash32(addr + "#" + strconv.Itoa(v))
+			if _, ok := r.indexes[h]; ok {
+				continue
+			}
+			r.indexes[h] = i
+			r.points = append(r.points, h)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		return r.points[i] < r.points[j]
+	})
+	return r
+}
+
+// get returns the index of the address responsible for key.
+func (r *hashRing) get(key string) int {
+	h := hash32(key)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= h
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.indexes[r.points[i]]
+}
+
+// hash32 returns the FNV-1a hash of s. As keys often only differ in their
+// last characters the result is mixed with the murmur3 finalizer to spread
+// them evenly around the ring.
+func hash32(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return mix32(h.Sum32())
+}
+
+// mix32 is the finalizer of murmur3. It spreads FNV hashes of similar keys,
+// which otherwise differ mostly in their high bits.
+func mix32(x uint32) uint32 {
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
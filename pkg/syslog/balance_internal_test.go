@@ -0,0 +1,35 @@
+package syslog
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pool", func() {
+	It("releases retired members once they have exited", func() {
+		o := NewOut(nil, nil)
+		p := o.newPool(&Sink{Name: "some-sink"}, nil, func() queue {
+			return newChanQueue(10, overflow{})
+		})
+
+		for i := 0; i < 100; i++ {
+			p.update([]endpoint{{addr: fmt.Sprintf("127.0.0.1:%d", 10000+i)}})
+			p.mu.RLock()
+			atomic.AddInt64(&p.members[0].messagesSent, 1)
+			p.mu.RUnlock()
+		}
+		p.update(nil)
+
+		retired := func() int {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.releaseRetired()
+			return len(p.retired)
+		}
+		Eventually(retired).Should(BeZero())
+		Expect(p.count(func(m *Sink) *int64 { return &m.messagesSent })).To(Equal(int64(100)))
+	})
+})
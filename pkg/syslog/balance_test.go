@@ -0,0 +1,174 @@
+package syslog_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Balance", func() {
+	// collect accepts a connection on the spy and returns the bodies
+	// received on it so far.
+	collect := func(spy *spySink) func() []string {
+		var (
+			mu     sync.Mutex
+			bodies []string
+		)
+		go func() {
+			conn, err := spy.lis.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			buf := bufio.NewReader(conn)
+			for {
+				var msg rfc5424.Message
+				_, err := msg.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				bodies = append(bodies, string(msg.Message))
+				mu.Unlock()
+			}
+		}()
+		return func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), bodies...)
+		}
+	}
+
+	It("distributes messages round robin", func() {
+		spyA := newSpySink()
+		defer spyA.stop()
+		spyB := newSpySink()
+		defer spyB.stop()
+		s := &syslog.Sink{
+			Namespace:    "ns1",
+			BalanceAddrs: []string{spyA.url(), spyB.url()},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		for i := 1; i <= 4; i++ {
+			out.Write(record(fmt.Sprintf("log-%d", i)), time.Unix(0, 0).UTC(), "pod.log")
+		}
+
+		spyA.expectReceivedWithBody("log-1\n", "log-3\n")
+		spyB.expectReceivedWithBody("log-2\n", "log-4\n")
+	})
+
+	It("sends all messages of a pod to the same address in order", func() {
+		spyA := newSpySink()
+		defer spyA.stop()
+		spyB := newSpySink()
+		defer spyB.stop()
+		s := &syslog.Sink{
+			Namespace:     "ns1",
+			BalanceAddrs:  []string{spyA.url(), spyB.url()},
+			BalancePolicy: syslog.BalanceHashPod,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+		receivedA := collect(spyA)
+		receivedB := collect(spyB)
+
+		for i := 0; i < 3; i++ {
+			for p := 0; p < 20; p++ {
+				pod := fmt.Sprintf("pod-%d", p)
+				out.Write(podRecord("ns1", pod, fmt.Sprintf("%s-%d", pod, i)), time.Unix(0, 0).UTC(), "pod.log")
+			}
+		}
+
+		Eventually(func() int {
+			return len(receivedA()) + len(receivedB())
+		}).Should(Equal(60))
+		Expect(receivedA()).ToNot(BeEmpty())
+		Expect(receivedB()).ToNot(BeEmpty())
+		for p := 0; p < 20; p++ {
+			pod := fmt.Sprintf("pod-%d", p)
+			var inA, inB []string
+			for _, b := range receivedA() {
+				if b[:len(pod)+1] == pod+"-" {
+					inA = append(inA, b)
+				}
+			}
+			for _, b := range receivedB() {
+				if b[:len(pod)+1] == pod+"-" {
+					inB = append(inB, b)
+				}
+			}
+			ordered := []string{pod + "-0\n", pod + "-1\n", pod + "-2\n"}
+			if len(inA) != 0 {
+				Expect(inA).To(Equal(ordered))
+				Expect(inB).To(BeEmpty())
+			} else {
+				Expect(inB).To(Equal(ordered))
+			}
+		}
+	})
+
+	It("reports the state of each connection", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		unused := unusedAddr()
+		s := &syslog.Sink{
+			Name:         "balanced",
+			Namespace:    "ns1",
+			BalanceAddrs: []string{spySink.url(), unused},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("first\n")
+		Eventually(s.MessagesDropped).Should(Equal(int64(1)))
+		state := out.SinkState()[0]
+		Expect(state.Name).To(Equal("balanced"))
+		Expect(state.Pool).To(HaveLen(2))
+		Expect(state.Pool[0].ActiveAddr).To(Equal(spySink.url()))
+		Expect(state.Pool[0].Error).To(BeNil())
+		Expect(state.Pool[1].ActiveAddr).To(Equal(unused))
+		Expect(state.Pool[1].Error).ToNot(BeNil())
+		Expect(state.Error).To(Equal(state.Pool[1].Error))
+	})
+
+	It("connects to each address of a host", func() {
+		spySink := newSpySink("127.0.0.1:0")
+		defer spySink.stop()
+		_, port, err := net.SplitHostPort(spySink.url())
+		Expect(err).ToNot(HaveOccurred())
+		s := &syslog.Sink{
+			Namespace:   "ns1",
+			BalanceHost: net.JoinHostPort("localhost", port),
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		var addrs []string
+		for _, p := range out.SinkState()[0].Pool {
+			addrs = append(addrs, p.ActiveAddr)
+		}
+		Expect(addrs).To(ContainElement(spySink.url()))
+	})
+
+	It("parses balance policies", func() {
+		p, err := syslog.ParseBalancePolicy("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal(syslog.BalanceRoundRobin))
+
+		p, err = syslog.ParseBalancePolicy("hash-pod")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal(syslog.BalanceHashPod))
+
+		_, err = syslog.ParseBalancePolicy("random")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,148 @@
+package syslog
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const defaultWriteLinger = 10 * time.Millisecond
+
+// writeBatch coalesces the messages of a sink into a buffer that is written
+// to the connection at once. It is only used from the sink's goroutine.
+type writeBatch struct {
+	size   int
+	linger time.Duration
+
+	buf   bytes.Buffer
+	msgs  []io.WriterTo
+	first time.Time
+	// count is the number of buffered messages for Flush, which checks it
+	// from other goroutines.
+	count int64
+}
+
+func newWriteBatch(s *Sink) *writeBatch {
+	if s.WriteBufferSize <= 0 {
+		return nil
+	}
+	b := &writeBatch{
+		size:   s.WriteBufferSize,
+		linger: s.WriteLinger,
+	}
+	if b.linger <= 0 {
+		b.linger = defaultWriteLinger
+	}
+	return b
+}
+
+// add appends the octet counted w to the buffer. It returns an error if w
+// can not be serialized, in which case it is not added.
+func (b *writeBatch) add(w io.WriterTo) error {
+	n := b.buf.Len()
+	_, err := w.WriteTo(&b.buf)
+	if err != nil {
+		b.buf.Truncate(n)
+		return err
+	}
+	if len(b.msgs) == 0 {
+		b.first = time.Now()
+	}
+	b.msgs = append(b.msgs, w)
+	atomic.AddInt64(&b.count, 1)
+	return nil
+}
+
+func (b *writeBatch) full() bool {
+	return b.buf.Len() >= b.size
+}
+
+// pending reports whether the batch holds messages that have not been
+// written.
+func (b *writeBatch) pending() bool {
+	return b != nil && len(b.msgs) > 0
+}
+
+// buffered is like pending but safe to call from any goroutine.
+func (b *writeBatch) buffered() bool {
+	return b != nil && atomic.LoadInt64(&b.count) > 0
+}
+
+// lingerLeft returns how much longer the buffered messages may wait for
+// more messages to join them.
+func (b *writeBatch) lingerLeft() time.Duration {
+	return b.linger - time.Since(b.first)
+}
+
+func (b *writeBatch) reset() {
+	b.buf.Reset()
+	b.msgs = b.msgs[:0]
+	atomic.StoreInt64(&b.count, 0)
+}
+
+// WriteTo writes the buffered messages to w in a single write.
+func (b *writeBatch) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(b.buf.Bytes())
+	return int64(n), err
+}
+
+// messageCount returns the number of messages w holds.
+func messageCount(w io.WriterTo) int64 {
+	switch b := w.(type) {
+	case *httpBatch:
+		return int64(len(b.msgs))
+	case *writeBatch:
+		return int64(len(b.msgs))
+	}
+	return 1
+}
+
+// next returns the next message of the sink's queue, or nil once the queue
+// is closed and empty. Buffered messages are written once they have
+// lingered long enough without the buffer filling up, and RELP frames an
+// ended session did not acknowledge are sent again while no messages
+// arrive.
+func (s *Sink) next() io.WriterTo {
+	if s.batch.pending() {
+		m, ok := s.messages.popTimeout(s.batch.lingerLeft())
+		if ok {
+			return m
+		}
+		s.flush()
+	}
+	for s.relp.unackedCount() > 0 {
+		m, ok := s.messages.popTimeout(relpResendInterval)
+		if ok {
+			return m
+		}
+		if s.relp.stale() {
+			s.resendRELP()
+		}
+	}
+	return s.messages.pop()
+}
+
+// buffer adds w to the sink's batch, writing the batch once it is full.
+func (s *Sink) buffer(w io.WriterTo) {
+	err := s.batch.add(w)
+	if err != nil {
+		// Let the write report the error.
+		s.flush()
+		s.deliver(w)
+		return
+	}
+	if s.batch.full() {
+		s.flush()
+	}
+}
+
+// flush writes the buffered messages. A failed batch is retried and
+// accounted for like a single message, counting each of its messages.
+func (s *Sink) flush() {
+	if !s.batch.pending() {
+		return
+	}
+	s.deliver(s.batch)
+	s.batch.reset()
+}
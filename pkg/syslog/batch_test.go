@@ -0,0 +1,184 @@
+package syslog_test
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Write batching", func() {
+	accept := func(spy *spySink) net.Conn {
+		err := spy.lis.(*net.TCPListener).SetDeadline(time.Now().Add(2 * time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		conn, err := spy.lis.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		return conn
+	}
+
+	bodies := func(data []byte) []string {
+		var bodies []string
+		buf := bufio.NewReader(bytes.NewReader(data))
+		for {
+			var msg rfc5424.Message
+			_, err := msg.ReadFrom(buf)
+			if err != nil {
+				return bodies
+			}
+			bodies = append(bodies, string(msg.Message))
+		}
+	}
+
+	DescribeTable("writes the messages of a linger period at once", func(cluster bool) {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:            spySink.url(),
+			Namespace:       "ns1",
+			WriteBufferSize: 64 * 1024,
+			WriteLinger:     300 * time.Millisecond,
+		}
+		var out *syslog.Out
+		if cluster {
+			out = syslog.NewOut(nil, []*syslog.Sink{s})
+		} else {
+			out = syslog.NewOut([]*syslog.Sink{s}, nil)
+		}
+
+		for _, msg := range []string{"first", "second", "third"} {
+			out.Write(record(msg), time.Unix(0, 0).UTC(), "pod.log")
+		}
+
+		conn := accept(spySink)
+		defer conn.Close()
+		buf := make([]byte, 64*1024)
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := conn.Read(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bodies(buf[:n])).To(Equal([]string{"first\n", "second\n", "third\n"}))
+		Expect(s.MessagesDropped()).To(BeZero())
+	},
+		Entry("namespace sinks", false),
+		Entry("cluster sinks", true),
+	)
+
+	It("writes the buffer once it is full", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:            spySink.url(),
+			Namespace:       "ns1",
+			WriteBufferSize: 1,
+			WriteLinger:     time.Hour,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("first\n", "second\n")
+	})
+
+	It("keeps messages buffered until the linger period ends", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:            spySink.url(),
+			Namespace:       "ns1",
+			WriteBufferSize: 64 * 1024,
+			WriteLinger:     500 * time.Millisecond,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		start := time.Now()
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("some-log\n")
+		Expect(time.Since(start)).To(BeNumerically(">=", 500*time.Millisecond))
+	})
+
+	It("writes buffered messages before Flush returns", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:            spySink.url(),
+			Namespace:       "ns1",
+			WriteBufferSize: 64 * 1024,
+			WriteLinger:     200 * time.Millisecond,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		for _, msg := range []string{"first", "second", "third"} {
+			out.Write(record(msg), time.Unix(0, 0).UTC(), "pod.log")
+		}
+
+		Expect(out.Flush(2 * time.Second)).To(BeTrue())
+		Expect(s.MessagesSent()).To(Equal(int64(3)))
+	})
+
+	It("gives up flushing after the timeout", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:            spySink.url(),
+			Namespace:       "ns1",
+			WriteBufferSize: 64 * 1024,
+			WriteLinger:     time.Hour,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Expect(out.Flush(100 * time.Millisecond)).To(BeFalse())
+		Expect(s.MessagesSent()).To(BeZero())
+	})
+
+	It("counts each message of a failed batch", func() {
+		addr := unusedAddr()
+		s := &syslog.Sink{
+			Addr:            addr,
+			Namespace:       "ns1",
+			WriteBufferSize: 64 * 1024,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		for _, msg := range []string{"first", "second", "third"} {
+			out.Write(record(msg), time.Unix(0, 0).UTC(), "pod.log")
+		}
+
+		Eventually(s.MessagesDropped).Should(Equal(int64(3)))
+		Expect(out.SinkState()[0].Error).ToNot(BeNil())
+	})
+
+	It("retries failed batches", func() {
+		addr := unusedAddr()
+		s := &syslog.Sink{
+			Addr:            addr,
+			Namespace:       "ns1",
+			WriteBufferSize: 64 * 1024,
+			Retry: &syslog.RetryPolicy{
+				MaxAttempts:    10,
+				InitialBackoff: 50 * time.Millisecond,
+				MaxBackoff:     50 * time.Millisecond,
+			},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+		Eventually(s.MessagesRetried).ShouldNot(BeZero())
+
+		spySink := newSpySink(addr)
+		defer spySink.stop()
+
+		spySink.expectReceivedWithBody("first\n", "second\n")
+		Expect(s.MessagesDropped()).To(BeZero())
+	})
+})
@@ -0,0 +1,101 @@
+package syslog
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const defaultBreakerOpenTimeout = 30 * time.Second
+
+// CircuitBreaker configures a sink to stop trying to write after
+// FailureThreshold consecutive failures. While the breaker is open messages
+// are dropped without dialing, or held in the queue if ParkMessages is set.
+// After OpenTimeout a single message is let through as a probe; if it
+// succeeds the breaker closes, otherwise it opens again.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	ParkMessages     bool
+}
+
+// Circuit breaker states as reported by SinkState.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// circuitBreaker is only used from the sink's goroutine; state is published
+// for SinkState.
+type circuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+	park        bool
+
+	failures int
+	openedAt time.Time
+	state    atomic.Value
+}
+
+func newCircuitBreaker(c *CircuitBreaker) *circuitBreaker {
+	if c == nil || c.FailureThreshold <= 0 {
+		return nil
+	}
+	b := &circuitBreaker{
+		threshold:   c.FailureThreshold,
+		openTimeout: c.OpenTimeout,
+		park:        c.ParkMessages,
+	}
+	if b.openTimeout <= 0 {
+		b.openTimeout = defaultBreakerOpenTimeout
+	}
+	b.state.Store(BreakerClosed)
+	return b
+}
+
+// allow reports whether a write may be attempted. When the breaker is open
+// it either returns false right away or, if messages are parked, waits until
+// a probe may be sent.
+func (b *circuitBreaker) allow() bool {
+	if b == nil || b.load() == BreakerClosed {
+		return true
+	}
+
+	probeAt := b.openedAt.Add(b.openTimeout)
+	if d := time.Until(probeAt); d > 0 {
+		if !b.park {
+			return false
+		}
+		time.Sleep(d)
+	}
+	b.state.Store(BreakerHalfOpen)
+	return true
+}
+
+func (b *circuitBreaker) succeed() {
+	if b == nil {
+		return
+	}
+	b.failures = 0
+	if b.load() != BreakerClosed {
+		b.state.Store(BreakerClosed)
+	}
+}
+
+func (b *circuitBreaker) fail(now time.Time) {
+	if b == nil {
+		return
+	}
+	b.failures++
+	if b.load() == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = now
+		b.state.Store(BreakerOpen)
+	}
+}
+
+func (b *circuitBreaker) load() string {
+	if b == nil {
+		return ""
+	}
+	return b.state.Load().(string)
+}
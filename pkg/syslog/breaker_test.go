@@ -0,0 +1,124 @@
+package syslog_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+	breakerState := func(out *syslog.Out) func() string {
+		return func() string {
+			return out.SinkState()[0].CircuitBreaker
+		}
+	}
+
+	It("does not report a state without a circuit breaker", func() {
+		s := &syslog.Sink{
+			Addr:      unusedAddr(),
+			Namespace: "ns1",
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		Expect(breakerState(out)()).To(BeEmpty())
+	})
+
+	It("opens after consecutive failures and fails fast", func() {
+		s := &syslog.Sink{
+			Addr:      unusedAddr(),
+			Namespace: "ns1",
+			CircuitBreaker: &syslog.CircuitBreaker{
+				FailureThreshold: 2,
+				OpenTimeout:      time.Hour,
+			},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+		Expect(breakerState(out)()).To(Equal(syslog.BreakerClosed))
+
+		for i := 0; i < 5; i++ {
+			out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+		}
+
+		Eventually(s.MessagesDropped).Should(Equal(int64(5)))
+		Expect(breakerState(out)()).To(Equal(syslog.BreakerOpen))
+	})
+
+	It("closes again after a successful probe", func() {
+		addr := unusedAddr()
+		s := &syslog.Sink{
+			Addr:      addr,
+			Namespace: "ns1",
+			CircuitBreaker: &syslog.CircuitBreaker{
+				FailureThreshold: 1,
+				OpenTimeout:      300 * time.Millisecond,
+			},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		Eventually(breakerState(out)).Should(Equal(syslog.BreakerOpen))
+
+		spySink := newSpySink(addr)
+		defer spySink.stop()
+		out.Write(record("while-open"), time.Unix(0, 0).UTC(), "pod.log")
+		Eventually(s.MessagesDropped).Should(Equal(int64(2)))
+
+		time.Sleep(300 * time.Millisecond)
+		out.Write(record("probe"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("probe\n")
+		Eventually(breakerState(out)).Should(Equal(syslog.BreakerClosed))
+	})
+
+	It("parks messages while open when configured", func() {
+		addr := unusedAddr()
+		s := &syslog.Sink{
+			Addr:      addr,
+			Namespace: "ns1",
+			CircuitBreaker: &syslog.CircuitBreaker{
+				FailureThreshold: 1,
+				OpenTimeout:      300 * time.Millisecond,
+				ParkMessages:     true,
+			},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		Eventually(breakerState(out)).Should(Equal(syslog.BreakerOpen))
+
+		spySink := newSpySink(addr)
+		defer spySink.stop()
+		out.Write(record("parked-1"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("parked-2"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("parked-1\n", "parked-2\n")
+		Expect(s.MessagesDropped()).To(Equal(int64(1)))
+		Expect(breakerState(out)()).To(Equal(syslog.BreakerClosed))
+	})
+
+	It("opens again when the probe fails", func() {
+		s := &syslog.Sink{
+			Addr:      unusedAddr(),
+			Namespace: "ns1",
+			CircuitBreaker: &syslog.CircuitBreaker{
+				FailureThreshold: 3,
+				OpenTimeout:      100 * time.Millisecond,
+			},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		for i := 0; i < 3; i++ {
+			out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+		}
+		Eventually(breakerState(out)).Should(Equal(syslog.BreakerOpen))
+
+		time.Sleep(100 * time.Millisecond)
+		out.Write(record("probe"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Eventually(s.MessagesDropped).Should(Equal(int64(4)))
+		Expect(breakerState(out)()).To(Equal(syslog.BreakerOpen))
+	})
+})
@@ -0,0 +1,149 @@
+package syslog
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// eventTime is the msgpack extension type 0 Fluent Bit encodes record
+// timestamps as: seconds and nanoseconds since the epoch, both as big endian
+// 32 bit integers.
+type eventTime struct {
+	time.Time
+}
+
+func (eventTime) WriteExt(v interface{}) []byte {
+	var t eventTime
+	switch ts := v.(type) {
+	case *eventTime:
+		t = *ts
+	case eventTime:
+		t = ts
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[4:], uint32(t.Nanosecond()))
+	return b
+}
+
+func (eventTime) ReadExt(v interface{}, b []byte) {
+	t := v.(*eventTime)
+	if len(b) != 8 {
+		return
+	}
+	sec := binary.BigEndian.Uint32(b)
+	nsec := binary.BigEndian.Uint32(b[4:])
+	t.Time = time.Unix(int64(sec), int64(nsec))
+}
+
+// chunkHandle returns the msgpack handle of chunks. Encoding event time
+// requires writeExt, which also makes strings decode as strings rather than
+// byte slices.
+func chunkHandle(writeExt bool) *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{WriteExt: writeExt}
+	_ = h.SetBytesExt(reflect.TypeOf(eventTime{}), 0, eventTime{})
+	return h
+}
+
+// ChunkDecoder decodes the records of a chunk of msgpack encoded records as
+// Fluent Bit passes them to output plugins. Each record is an array of the
+// timestamp and a map. As with the decoder of Fluent Bit, map keys are
+// decoded as strings and string values as byte slices.
+type ChunkDecoder struct {
+	dec  *codec.Decoder
+	size int
+}
+
+// NewChunkDecoder returns a decoder of the records in data.
+func NewChunkDecoder(data []byte) *ChunkDecoder {
+	return &ChunkDecoder{
+		dec:  codec.NewDecoderBytes(data, chunkHandle(false)),
+		size: len(data),
+	}
+}
+
+// Next returns the timestamp and the map of the next record. It returns
+// io.EOF once all records are decoded and io.ErrUnexpectedEOF if the chunk
+// ends within a record.
+func (d *ChunkDecoder) Next() (time.Time, map[interface{}]interface{}, error) {
+	if d.dec.NumBytesRead() >= d.size {
+		return time.Time{}, nil, io.EOF
+	}
+	var entry []interface{}
+	err := d.dec.Decode(&entry)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	if len(entry) != 2 {
+		return time.Time{}, nil, errors.New("record is not an array of timestamp and map")
+	}
+	record, ok := entry[1].(map[interface{}]interface{})
+	if !ok {
+		return time.Time{}, nil, errors.New("record is not a map")
+	}
+	return recordTime(entry[0]), record, nil
+}
+
+// recordTime returns the time of a record's timestamp. Records without a
+// valid timestamp are given the current time.
+func recordTime(ts interface{}) time.Time {
+	switch t := ts.(type) {
+	case eventTime:
+		if !t.IsZero() {
+			return t.Time
+		}
+	case uint64:
+		// From our observation, when ts is of type uint64 it appears to
+		// be the amount of seconds since unix epoch.
+		return time.Unix(int64(t), 0)
+	}
+	return time.Now()
+}
+
+// ChunkEncoder encodes records the way Fluent Bit passes them to output
+// plugins, for tests and tools replaying records.
+type ChunkEncoder struct {
+	enc *codec.Encoder
+}
+
+// NewChunkEncoder returns an encoder writing to w.
+func NewChunkEncoder(w io.Writer) *ChunkEncoder {
+	return &ChunkEncoder{
+		enc: codec.NewEncoder(w, chunkHandle(true)),
+	}
+}
+
+// Encode writes a record with the given timestamp as event time. String
+// values are encoded as msgpack strings and byte slices as binary.
+func (e *ChunkEncoder) Encode(ts time.Time, record map[string]interface{}) error {
+	return e.enc.Encode([]interface{}{&eventTime{Time: ts}, record})
+}
+
+// WriteChunk decodes the records of a chunk as Fluent Bit passes them to
+// output plugins and writes them with the given tag. It returns the number
+// of records written, which are all records of the chunk unless an error
+// is returned. Once WriteChunk returns the records are queued on their
+// sinks.
+func (o *Out) WriteChunk(data []byte, tag string) (int, error) {
+	defer o.Wait()
+
+	dec := NewChunkDecoder(data)
+	for n := 0; ; n++ {
+		ts, record, err := dec.Next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		o.Write(record, ts, tag)
+	}
+}
@@ -0,0 +1,96 @@
+package syslog_test
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Chunks", func() {
+	record := func(log string) map[string]interface{} {
+		return map[string]interface{}{
+			"log": log,
+			"kubernetes": map[string]interface{}{
+				"namespace_name": "ns1",
+				"pod_name":       "pod-name",
+				"container_name": "container-name",
+			},
+		}
+	}
+
+	It("decodes the records it encoded", func() {
+		var buf bytes.Buffer
+		enc := syslog.NewChunkEncoder(&buf)
+		ts := time.Unix(1565000000, 123456789).UTC()
+		Expect(enc.Encode(ts, record("some-log"))).To(Succeed())
+		Expect(enc.Encode(ts.Add(time.Second), record("other-log"))).To(Succeed())
+
+		dec := syslog.NewChunkDecoder(buf.Bytes())
+		decodedTS, r, err := dec.Next()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decodedTS.Equal(ts)).To(BeTrue())
+		Expect(r["log"]).To(Equal([]byte("some-log")))
+		k8s := r["kubernetes"].(map[interface{}]interface{})
+		Expect(k8s["pod_name"]).To(Equal([]byte("pod-name")))
+
+		decodedTS, r, err = dec.Next()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decodedTS.Equal(ts.Add(time.Second))).To(BeTrue())
+		Expect(r["log"]).To(Equal([]byte("other-log")))
+
+		_, _, err = dec.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("decodes timestamps given in seconds", func() {
+		// [1565000000, {"log": "some-log"}]
+		chunk := []byte("\x92\xce\x5d\x48\x01\x40\x81\xa3log\xa8some-log")
+
+		ts, r, err := syslog.NewChunkDecoder(chunk).Next()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ts.Equal(time.Unix(1565000000, 0))).To(BeTrue())
+		Expect(r["log"]).To(Equal([]byte("some-log")))
+	})
+
+	It("writes the records of a chunk", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:      spySink.url(),
+			Namespace: "ns1",
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		var buf bytes.Buffer
+		enc := syslog.NewChunkEncoder(&buf)
+		Expect(enc.Encode(time.Unix(0, 0), record("some-log"))).To(Succeed())
+		Expect(enc.Encode(time.Unix(1, 0), record("other-log"))).To(Succeed())
+
+		n, err := out.WriteChunk(buf.Bytes(), "pod.log")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(2))
+
+		spySink.expectReceived(
+			`<14>1 1970-01-01T00:00:00+00:00 - pod.log/ns1/pod-name/container-name - - [kubernetes@47450 namespace_name="ns1" object_name="pod-name" container_name="container-name"] some-log`+"\n",
+			`<14>1 1970-01-01T00:00:01+00:00 - pod.log/ns1/pod-name/container-name - - [kubernetes@47450 namespace_name="ns1" object_name="pod-name" container_name="container-name"] other-log`+"\n",
+		)
+	})
+
+	It("stops at records that can not be decoded", func() {
+		out := syslog.NewOut(nil, nil)
+
+		var buf bytes.Buffer
+		enc := syslog.NewChunkEncoder(&buf)
+		Expect(enc.Encode(time.Unix(0, 0), record("some-log"))).To(Succeed())
+		buf.WriteString("\x92\x01")
+
+		n, err := out.WriteChunk(buf.Bytes(), "pod.log")
+		Expect(err).To(HaveOccurred())
+		Expect(n).To(Equal(1))
+	})
+})
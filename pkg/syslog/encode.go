@@ -0,0 +1,209 @@
+package syslog
+
+import (
+	"io"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+// encodedMessage is a message routed to one or more sinks. It is serialized
+// at most once, by whichever sink writes it first, and the bytes are shared
+// by all sinks. Neither the message nor the bytes may be modified.
+type encodedMessage struct {
+	msg *rfc5424.Message
+
+	once   sync.Once
+	framed []byte
+	raw    []byte
+	err    error
+}
+
+func newEncodedMessage(msg *rfc5424.Message) *encodedMessage {
+	return &encodedMessage{msg: msg}
+}
+
+// frameReserve is the room left in front of a serialized message for its
+// octet count, which has at most 10 digits, and the space that follows.
+const frameReserve = 11
+
+func (m *encodedMessage) encode() {
+	m.once.Do(func() {
+		b := make([]byte, frameReserve, frameReserve+encodedSize(m.msg))
+		b, err := appendMessage(b, m.msg)
+		if err != nil {
+			m.err = err
+			return
+		}
+		var digits [frameReserve]byte
+		count := strconv.AppendInt(digits[:0], int64(len(b)-frameReserve), 10)
+		start := frameReserve - len(count) - 1
+		copy(b[start:], count)
+		b[frameReserve-1] = ' '
+		m.framed = b[start:]
+		// Limit the capacity so that appending to raw copies it instead
+		// of writing to the shared bytes.
+		m.raw = b[frameReserve:len(b):len(b)]
+	})
+}
+
+// encodedSize returns roughly how many bytes appendMessage appends for msg.
+func encodedSize(msg *rfc5424.Message) int {
+	n := 64 + len(msg.Hostname) + len(msg.AppName) + len(msg.ProcessID) + len(msg.MessageID) + len(msg.Message)
+	for _, e := range msg.StructuredData {
+		n += len(e.ID) + 2
+		for _, p := range e.Parameters {
+			n += len(p.Name) + len(p.Value) + 4
+		}
+	}
+	return n
+}
+
+// appendMessage appends the RFC 5424 serialization of msg to b. The result
+// and errors are those of rfc5424.Message.MarshalBinary, which formats the
+// header with fmt and allocates for each of its fields.
+func appendMessage(b []byte, msg *rfc5424.Message) ([]byte, error) {
+	if err := validateMessage(msg); err != nil {
+		return b, err
+	}
+
+	b = append(b, '<')
+	b = strconv.AppendInt(b, int64(msg.Priority), 10)
+	b = append(b, ">1 "...)
+	b = msg.Timestamp.AppendFormat(b, rfc5424.RFC5424TimeOffsetNum)
+	for _, f := range []string{msg.Hostname, msg.AppName, msg.ProcessID, msg.MessageID} {
+		b = append(b, ' ')
+		b = appendNil(b, f)
+	}
+	b = append(b, ' ')
+
+	if len(msg.StructuredData) == 0 {
+		b = append(b, '-')
+	}
+	for _, e := range msg.StructuredData {
+		b = append(b, '[')
+		b = append(b, e.ID...)
+		for _, p := range e.Parameters {
+			b = append(b, ' ')
+			b = append(b, p.Name...)
+			b = append(b, '=', '"')
+			b = appendSDParamValue(b, p.Value)
+			b = append(b, '"')
+		}
+		b = append(b, ']')
+	}
+
+	if len(msg.Message) > 0 {
+		b = append(b, ' ')
+		b = append(b, msg.Message...)
+	}
+	return b, nil
+}
+
+// appendNil appends s, or the NILVALUE if s is empty.
+func appendNil(b []byte, s string) []byte {
+	if s == "" {
+		return append(b, '-')
+	}
+	return append(b, s...)
+}
+
+// appendSDParamValue appends s with the characters RFC 5424 requires to be
+// escaped in parameter values escaped.
+func appendSDParamValue(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"', ']':
+			b = append(b, '\\', c)
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+// validateMessage checks the fields of msg the way
+// rfc5424.Message.MarshalBinary does.
+func validateMessage(msg *rfc5424.Message) error {
+	header := []struct {
+		property string
+		value    string
+		max      int
+	}{
+		{"Hostname", msg.Hostname, 255},
+		{"AppName", msg.AppName, 48},
+		{"ProcessID", msg.ProcessID, 128},
+		{"MessageID", msg.MessageID, 32},
+	}
+	for _, h := range header {
+		if !isPrintableUSASCII(h.value) || len(h.value) > h.max {
+			return rfc5424.ErrInvalidValue{Property: h.property, Value: h.value}
+		}
+	}
+
+	for _, e := range msg.StructuredData {
+		if !isValidSDName(e.ID) {
+			return rfc5424.ErrInvalidValue{Property: "StructuredData/ID", Value: e.ID}
+		}
+		for _, p := range e.Parameters {
+			if !isValidSDName(p.Name) {
+				return rfc5424.ErrInvalidValue{Property: "StructuredData/Name", Value: p.Name}
+			}
+			if !utf8.ValidString(p.Value) {
+				return rfc5424.ErrInvalidValue{Property: "StructuredData/Value", Value: p.Value}
+			}
+		}
+	}
+	return nil
+}
+
+func isPrintableUSASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 33 || s[i] > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidSDName reports whether s is a valid SD-ID or PARAM-NAME. Like the
+// rfc5424 package, names longer than 32 characters are allowed.
+func isValidSDName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c < 33 || c > 126, c == '=', c == ']', c == '"':
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary returns the RFC 5424 serialization of the message.
+func (m *encodedMessage) MarshalBinary() ([]byte, error) {
+	m.encode()
+	return m.raw, m.err
+}
+
+// WriteTo writes the message octet counted as described in RFC 6587, as
+// rfc5424.Message.WriteTo does.
+func (m *encodedMessage) WriteTo(w io.Writer) (int64, error) {
+	m.encode()
+	if m.err != nil {
+		return 0, m.err
+	}
+	n, err := w.Write(m.framed)
+	return int64(n), err
+}
+
+// rfc5424Message returns the message w holds if it is an rfc5424 message.
+func rfc5424Message(w io.WriterTo) (*rfc5424.Message, bool) {
+	switch m := w.(type) {
+	case *rfc5424.Message:
+		return m, true
+	case *encodedMessage:
+		return m.msg, true
+	}
+	return nil, false
+}
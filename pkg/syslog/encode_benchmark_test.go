@@ -0,0 +1,64 @@
+package syslog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+// The benchmarks compare every sink marshaling a routed message on its own
+// with the sinks sharing a single encoding.
+
+func benchmarkMessage() *rfc5424.Message {
+	return &rfc5424.Message{
+		Priority:  rfc5424.Info + rfc5424.User,
+		Timestamp: time.Unix(0, 0).UTC(),
+		Hostname:  "some-host",
+		AppName:   "ns1/pod/pod-name",
+		ProcessID: "[container-name]",
+		StructuredData: []rfc5424.StructuredData{
+			{
+				ID: "kubernetes@47450",
+				Parameters: []rfc5424.SDParam{
+					{Name: "app", Value: "some-app"},
+					{Name: "namespace_name", Value: "ns1"},
+					{Name: "object_name", Value: "pod-name"},
+					{Name: "container_name", Value: "container-name"},
+				},
+			},
+		},
+		Message: []byte("some log message of a typical length for a container writing to stdout\n"),
+	}
+}
+
+func BenchmarkMarshalPerSink(b *testing.B) {
+	for _, sinks := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("sinks=%d", sinks), func(b *testing.B) {
+			msg := benchmarkMessage()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < sinks; j++ {
+					_, _ = msg.WriteTo(ioutil.Discard)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMarshalShared(b *testing.B) {
+	for _, sinks := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("sinks=%d", sinks), func(b *testing.B) {
+			msg := benchmarkMessage()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				enc := newEncodedMessage(msg)
+				for j := 0; j < sinks; j++ {
+					_, _ = enc.WriteTo(ioutil.Discard)
+				}
+			}
+		})
+	}
+}
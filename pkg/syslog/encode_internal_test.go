@@ -0,0 +1,79 @@
+package syslog
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("encodedMessage", func() {
+	message := func() *rfc5424.Message {
+		return &rfc5424.Message{
+			Priority:  rfc5424.Info + rfc5424.User,
+			Timestamp: time.Date(2020, 1, 2, 3, 4, 5, 678000, time.FixedZone("", -7*3600)),
+			Hostname:  "some-host",
+			AppName:   "pod.log/ns1/pod-name/container-name",
+			Message:   []byte("some-log\n"),
+			StructuredData: []rfc5424.StructuredData{{
+				ID: "kubernetes@47450",
+				Parameters: []rfc5424.SDParam{
+					{Name: "namespace_name", Value: "ns1"},
+					{Name: "label", Value: `some "quoted" \ value]`},
+				},
+			}},
+		}
+	}
+
+	DescribeTable("serializes messages like the rfc5424 package",
+		func(modify func(*rfc5424.Message)) {
+			msg := message()
+			modify(msg)
+			want, wantErr := msg.MarshalBinary()
+
+			enc := newEncodedMessage(msg)
+			raw, err := enc.MarshalBinary()
+			if wantErr != nil {
+				Expect(err).To(Equal(wantErr))
+				return
+			}
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(raw)).To(Equal(string(want)))
+
+			var framed, wantFramed bytes.Buffer
+			_, err = enc.WriteTo(&framed)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = msg.WriteTo(&wantFramed)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(framed.String()).To(Equal(wantFramed.String()))
+		},
+		Entry("with structured data", func(*rfc5424.Message) {}),
+		Entry("without structured data", func(m *rfc5424.Message) { m.StructuredData = nil }),
+		Entry("with nil values", func(m *rfc5424.Message) {
+			m.Hostname = ""
+			m.AppName = ""
+			m.Message = nil
+		}),
+		Entry("with process and message IDs", func(m *rfc5424.Message) {
+			m.ProcessID = "123"
+			m.MessageID = "some-id"
+		}),
+		Entry("with a long message", func(m *rfc5424.Message) {
+			m.Message = bytes.Repeat([]byte("x"), 70000)
+		}),
+		Entry("with an invalid hostname", func(m *rfc5424.Message) { m.Hostname = "some host" }),
+		Entry("with a long app name", func(m *rfc5424.Message) { m.AppName = strings.Repeat("a", 49) }),
+		Entry("with a non-ASCII message ID", func(m *rfc5424.Message) { m.MessageID = "ïd" }),
+		Entry("with an invalid SD-ID", func(m *rfc5424.Message) { m.StructuredData[0].ID = "some=id" }),
+		Entry("with an invalid parameter name", func(m *rfc5424.Message) {
+			m.StructuredData[0].Parameters[0].Name = `some"name`
+		}),
+		Entry("with an invalid parameter value", func(m *rfc5424.Message) {
+			m.StructuredData[0].Parameters[0].Value = "\xff"
+		}),
+	)
+})
@@ -0,0 +1,151 @@
+package syslog
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const defaultFailbackInterval = time.Minute
+
+// failover tracks which of a sink's addresses is in use. Addresses are
+// preferred in order. It is only used from the sink's goroutine; the active
+// address is published for SinkState.
+type failover struct {
+	addrs    []string
+	interval time.Duration
+	// lookup looks up the addresses again before the next connection
+	// attempt. It is set while the sink's SRV records could not be looked
+	// up.
+	lookup func() ([]string, error)
+
+	active     int
+	lastCheck  time.Time
+	activeAddr atomic.Value
+}
+
+func newFailover(addrs []string, interval time.Duration, lookup func() ([]string, error)) *failover {
+	f := &failover{
+		interval: interval,
+		lookup:   lookup,
+	}
+	if f.interval <= 0 {
+		f.interval = defaultFailbackInterval
+	}
+	f.setAddrs(addrs)
+	return f
+}
+
+// setAddrs replaces the addresses and makes the first one active.
+func (f *failover) setAddrs(addrs []string) {
+	f.addrs = addrs
+	f.active = 0
+	var addr string
+	if len(addrs) > 0 {
+		addr = addrs[0]
+	}
+	f.activeAddr.Store(addr)
+}
+
+// connect dials the active address and, if that fails, every other address
+// in order. The error of the active address is returned if none succeed.
+func (f *failover) connect(dial func(string) (net.Conn, error)) (net.Conn, error) {
+	if f.lookup != nil {
+		addrs, err := f.lookup()
+		if err == nil {
+			f.lookup = nil
+			f.setAddrs(addrs)
+		} else if len(f.addrs) == 0 {
+			return nil, err
+		}
+	}
+	if len(f.addrs) == 0 {
+		return nil, errors.New("no addresses to connect to")
+	}
+	var firstErr error
+	for i := range f.addrs {
+		idx := (f.active + i) % len(f.addrs)
+		conn, err := dial(f.addrs[idx])
+		if err == nil {
+			f.setActive(idx)
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// failback dials the addresses preferred over the active one once per
+// failback interval and returns a connection to the first that succeeds.
+func (f *failover) failback(dial func(string) (net.Conn, error)) net.Conn {
+	if f.active == 0 || time.Since(f.lastCheck) < f.interval {
+		return nil
+	}
+	f.lastCheck = time.Now()
+
+	for idx := 0; idx < f.active; idx++ {
+		conn, err := dial(f.addrs[idx])
+		if err == nil {
+			f.setActive(idx)
+			return conn
+		}
+	}
+	return nil
+}
+
+// writeFailed moves on to the next address for the next connection.
+func (f *failover) writeFailed() {
+	if len(f.addrs) == 0 {
+		return
+	}
+	f.active = (f.active + 1) % len(f.addrs)
+}
+
+func (f *failover) setActive(idx int) {
+	addr := f.addrs[idx]
+	if prev := f.load(); prev != addr {
+		log.Printf("[out_syslog] Sink switched from %s to %s\n", RedactAddr(prev), RedactAddr(addr))
+		f.lastCheck = time.Now()
+	}
+	f.active = idx
+	f.activeAddr.Store(addr)
+}
+
+func (f *failover) load() string {
+	return f.activeAddr.Load().(string)
+}
+
+// maintainConnection establishes a connection to one of the sink's
+// addresses if there is none, and fails back to a preferred address if one
+// has become available. The connection is re-established if the sink's
+// addresses resolve differently than before, or if it has reached its
+// maximum age or idle timeout.
+func (s *Sink) maintainConnection() error {
+	now := time.Now()
+	if addrs, changed := s.rotation.check(now); changed {
+		log.Printf("[out_syslog] Addresses of sink %s changed, reconnecting\n", s.Name)
+		s.failover.lookup = nil
+		s.failover.setAddrs(addrs)
+		s.closeConn()
+	}
+	s.recycleConnection(now)
+
+	if conn := s.failover.failback(s.dial); conn != nil {
+		s.setConn(conn)
+		return nil
+	}
+	if s.conn != nil {
+		return nil
+	}
+
+	conn, err := s.failover.connect(s.dial)
+	if err != nil {
+		return err
+	}
+	s.setConn(conn)
+	return nil
+}
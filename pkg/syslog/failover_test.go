@@ -0,0 +1,92 @@
+package syslog_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Failover", func() {
+	activeAddr := func(out *syslog.Out) func() string {
+		return func() string {
+			return out.SinkState()[0].ActiveAddr
+		}
+	}
+
+	It("reports the primary address as active", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:          spySink.url(),
+			Namespace:     "ns1",
+			FailoverAddrs: []string{unusedAddr()},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("some-log\n")
+		Expect(activeAddr(out)()).To(Equal(spySink.url()))
+	})
+
+	It("fails over to the next reachable address", func() {
+		drSink := newSpySink()
+		defer drSink.stop()
+		s := &syslog.Sink{
+			Addr:          unusedAddr(),
+			Namespace:     "ns1",
+			FailoverAddrs: []string{unusedAddr(), drSink.url()},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		drSink.expectReceivedWithBody("some-log\n")
+		Expect(activeAddr(out)()).To(Equal(drSink.url()))
+		Expect(s.MessagesDropped()).To(BeZero())
+	})
+
+	It("fails back to the primary address once it is reachable", func() {
+		primaryAddr := unusedAddr()
+		drSink := newSpySink()
+		defer drSink.stop()
+		s := &syslog.Sink{
+			Addr:             primaryAddr,
+			Namespace:        "ns1",
+			FailoverAddrs:    []string{drSink.url()},
+			FailbackInterval: 200 * time.Millisecond,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("to-dr"), time.Unix(0, 0).UTC(), "pod.log")
+		drSink.expectReceivedWithBody("to-dr\n")
+
+		primarySink := newSpySink(primaryAddr)
+		defer primarySink.stop()
+		time.Sleep(200 * time.Millisecond)
+		out.Write(record("to-primary"), time.Unix(0, 0).UTC(), "pod.log")
+
+		primarySink.expectReceivedWithBody("to-primary\n")
+		Expect(activeAddr(out)()).To(Equal(primaryAddr))
+	})
+
+	It("reports the error of the active address if none are reachable", func() {
+		primaryAddr := unusedAddr()
+		s := &syslog.Sink{
+			Addr:          primaryAddr,
+			Namespace:     "ns1",
+			FailoverAddrs: []string{unusedAddr()},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Eventually(func() *syslog.SinkError {
+			return out.SinkState()[0].Error
+		}).ShouldNot(BeNil())
+		Expect(out.SinkState()[0].Error.Msg).To(ContainSubstring(primaryAddr))
+	})
+})
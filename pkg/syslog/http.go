@@ -0,0 +1,320 @@
+package syslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPFraming determines how the messages of a batch are separated in the
+// body of a request to an HTTPS drain.
+type HTTPFraming string
+
+const (
+	// HTTPFramingOctetCounted prefixes each message with its length as
+	// described in RFC 6587.
+	HTTPFramingOctetCounted HTTPFraming = "octet-counted"
+	// HTTPFramingNewline terminates each message with a newline unless it
+	// already ends with one.
+	HTTPFramingNewline HTTPFraming = "newline"
+)
+
+const (
+	defaultHTTPBatchSize = 100
+	defaultHTTPBatchAge  = time.Second
+	defaultHTTPTimeout   = 10 * time.Second
+)
+
+// ParseHTTPFraming returns the HTTPFraming for the given configuration
+// value. An empty value results in HTTPFramingOctetCounted.
+func ParseHTTPFraming(s string) (HTTPFraming, error) {
+	switch f := HTTPFraming(s); f {
+	case "":
+		return HTTPFramingOctetCounted, nil
+	case HTTPFramingOctetCounted, HTTPFramingNewline:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown HTTP framing %q", s)
+}
+
+// HTTPDrain configures sinks whose Addr is an https:// URL. Messages are
+// POSTed to the URL in batches of up to BatchSize messages (default 100),
+// sent once the first message of a batch is BatchAge old (default one
+// second). Credentials in the URL are sent using basic auth.
+type HTTPDrain struct {
+	Framing   HTTPFraming
+	Headers   map[string]string
+	Gzip      bool
+	BatchSize int
+	BatchAge  time.Duration
+	// Timeout limits each request and defaults to ten seconds.
+	Timeout time.Duration
+}
+
+// isHTTPAddr reports whether addr is the URL of an HTTPS drain.
+func isHTTPAddr(addr string) bool {
+	return strings.HasPrefix(addr, "https://")
+}
+
+// RedactAddr returns addr with the password in the userinfo of an HTTPS
+// drain URL replaced, so that the address can be logged or exposed.
+func RedactAddr(addr string) string {
+	if !isHTTPAddr(addr) {
+		return addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		if i := strings.LastIndex(addr, "@"); i >= 0 {
+			return "https://xxxxx" + addr[i:]
+		}
+		return addr
+	}
+	if u.User == nil {
+		return addr
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
+
+// httpDrain batches the messages of a sink and POSTs them to its URL.
+// Batches are delivered from the drain's goroutine.
+type httpDrain struct {
+	url       string
+	framing   HTTPFraming
+	headers   map[string]string
+	gzip      bool
+	batchSize int
+	batchAge  time.Duration
+	client    *http.Client
+	tlsErr    error
+
+	msgs chan io.WriterTo
+	done chan struct{}
+	// queued counts the messages added but not yet delivered.
+	queued int64
+}
+
+func (o *Out) newHTTPDrain(s *Sink) *httpDrain {
+	cfg := s.HTTP
+	if cfg == nil {
+		cfg = &HTTPDrain{}
+	}
+	d := &httpDrain{
+		url:       s.Addr,
+		framing:   cfg.Framing,
+		headers:   cfg.Headers,
+		gzip:      cfg.Gzip,
+		batchSize: cfg.BatchSize,
+		batchAge:  cfg.BatchAge,
+		msgs:      make(chan io.WriterTo),
+		done:      make(chan struct{}),
+	}
+	if d.batchSize <= 0 {
+		d.batchSize = defaultHTTPBatchSize
+	}
+	if d.batchAge <= 0 {
+		d.batchAge = defaultHTTPBatchAge
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+
+	dialer := o.dialer(s)
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		TLSHandshakeTimeout: o.dialTimeout,
+	}
+	if s.TLS != nil {
+		transport.TLSClientConfig, d.tlsErr = tlsConfig(s.TLS, "")
+	}
+	d.client = &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+	return d
+}
+
+// add adds w to the current batch.
+func (d *httpDrain) add(w io.WriterTo) {
+	atomic.AddInt64(&d.queued, 1)
+	d.msgs <- w
+}
+
+// buffered reports whether messages wait to be delivered.
+func (d *httpDrain) buffered() bool {
+	return d != nil && atomic.LoadInt64(&d.queued) > 0
+}
+
+// close delivers the current batch and stops the drain's goroutine.
+func (d *httpDrain) close() {
+	if d == nil {
+		return
+	}
+	close(d.msgs)
+	<-d.done
+}
+
+// run collects messages into batches and passes them to deliver once they
+// are full or old enough.
+func (d *httpDrain) run(deliver func(io.WriterTo)) {
+	defer close(d.done)
+
+	var batch *httpBatch
+	timer := time.NewTimer(d.batchAge)
+	timer.Stop()
+	flush := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		deliver(batch)
+		atomic.AddInt64(&d.queued, -int64(len(batch.msgs)))
+		batch = nil
+	}
+
+	for {
+		select {
+		case w, ok := <-d.msgs:
+			if !ok {
+				if batch != nil {
+					flush()
+				}
+				return
+			}
+			if batch == nil {
+				batch = &httpBatch{framing: d.framing}
+				timer.Reset(d.batchAge)
+			}
+			batch.msgs = append(batch.msgs, w)
+			if len(batch.msgs) >= d.batchSize {
+				flush()
+			}
+		case <-timer.C:
+			if batch != nil {
+				deliver(batch)
+				atomic.AddInt64(&d.queued, -int64(len(batch.msgs)))
+				batch = nil
+			}
+		}
+	}
+}
+
+// post sends w in a single request. Responses with status 429 or 5xx
+// result in errors that are retried, other unsuccessful responses in
+// permanent errors.
+func (d *httpDrain) post(w io.WriterTo) error {
+	if d.tlsErr != nil {
+		return d.tlsErr
+	}
+
+	var body bytes.Buffer
+	if d.gzip {
+		zw := gzip.NewWriter(&body)
+		_, err := w.WriteTo(zw)
+		if err != nil {
+			return err
+		}
+		err = zw.Close()
+		if err != nil {
+			return err
+		}
+	} else {
+		_, err := w.WriteTo(&body)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.url, &body)
+	if err != nil {
+		return permanentError{fmt.Errorf("invalid drain URL %s", RedactAddr(d.url))}
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	if d.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range d.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("http drain responded with %s", resp.Status)
+	}
+	return permanentError{fmt.Errorf("http drain responded with %s", resp.Status)}
+}
+
+// httpBatch is the body of a request to an HTTPS drain.
+type httpBatch struct {
+	framing HTTPFraming
+	msgs    []io.WriterTo
+}
+
+// WriteTo writes the framed messages of the batch to w.
+func (b *httpBatch) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, m := range b.msgs {
+		n, err := b.writeMessage(w, m)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (b *httpBatch) writeMessage(w io.Writer, m io.WriterTo) (int64, error) {
+	if b.framing != HTTPFramingNewline {
+		return m.WriteTo(w)
+	}
+	bm, ok := m.(encoding.BinaryMarshaler)
+	if !ok {
+		return 0, fmt.Errorf("http drain: unsupported message type %T", m)
+	}
+	data, err := bm.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// permanentError is an error writing messages that will not succeed when
+// retried.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
@@ -0,0 +1,95 @@
+package syslog
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// dialer returns the dialer for the connections of s.
+func (o *Out) dialer(s *Sink) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   o.dialTimeout,
+		KeepAlive: s.KeepAlive,
+	}
+}
+
+// setConn makes conn the sink's connection, closing the previous one.
+func (s *Sink) setConn(conn net.Conn) {
+	s.closeConn()
+	s.conn = conn
+	s.connectedAt = time.Now()
+	s.connClosed = new(int32)
+	s.connWatch.Store(s.connClosed)
+	if s.relp != nil {
+		s.relp.attach(conn, s.connClosed)
+		return
+	}
+	go watch(conn, s.connClosed)
+}
+
+// watch reads from conn until the receiver closes it, which is then
+// recorded in closed. Receivers of octet counted messages never write back,
+// so this is how a closed connection is noticed before writing to it. Reads
+// end as well when the sink closes conn itself.
+func watch(conn io.Reader, closed *int32) {
+	_, _ = io.Copy(ioutil.Discard, conn)
+	atomic.StoreInt32(closed, 1)
+}
+
+// closeConn closes the sink's connection if it has one.
+func (s *Sink) closeConn() {
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+	if s.conn != nil {
+		if s.relp != nil {
+			s.relp.close(s.writeTimeout)
+		}
+		s.conn.Close()
+		s.conn = nil
+		s.connWatch.Store((*int32)(nil))
+	}
+}
+
+// connected reports whether the sink has a connection that has not been
+// closed by the receiver. It is safe to call from any goroutine.
+func (s *Sink) connected() bool {
+	closed, _ := s.connWatch.Load().(*int32)
+	return closed != nil && atomic.LoadInt32(closed) == 0
+}
+
+// recycleConnection closes the sink's connection if it has reached its
+// maximum age, was closed for being idle or was closed by the receiver so
+// that the next message is written to a new connection. It must be called
+// before writing.
+func (s *Sink) recycleConnection(now time.Time) {
+	if s.conn == nil {
+		return
+	}
+	// The idle timer is stopped while writing. If it already fired the
+	// connection has been closed.
+	idled := s.idleTimer != nil && !s.idleTimer.Stop()
+	aged := s.MaxConnectionAge > 0 && now.Sub(s.connectedAt) >= s.MaxConnectionAge
+	if idled || aged || atomic.LoadInt32(s.connClosed) == 1 {
+		s.closeConn()
+	}
+}
+
+// wrote starts the idle timer of the connection after a write.
+func (s *Sink) wrote() {
+	if s.IdleTimeout <= 0 || s.conn == nil {
+		return
+	}
+	if s.idleTimer != nil {
+		s.idleTimer.Reset(s.IdleTimeout)
+		return
+	}
+	conn := s.conn
+	s.idleTimer = time.AfterFunc(s.IdleTimeout, func() {
+		conn.Close()
+	})
+}
@@ -0,0 +1,154 @@
+package syslog_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Connection lifetime", func() {
+	accept := func(spy *spySink) (net.Conn, *bufio.Reader) {
+		err := spy.lis.(*net.TCPListener).SetDeadline(time.Now().Add(2 * time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		conn, err := spy.lis.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		return conn, bufio.NewReader(conn)
+	}
+
+	readBody := func(conn net.Conn, buf *bufio.Reader) (string, error) {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var msg rfc5424.Message
+		_, err := msg.ReadFrom(buf)
+		return string(msg.Message), err
+	}
+
+	It("reconnects once a connection reaches its maximum age", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:             spySink.url(),
+			Namespace:        "ns1",
+			MaxConnectionAge: 100 * time.Millisecond,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		conn1, buf1 := accept(spySink)
+		defer conn1.Close()
+		Expect(readBody(conn1, buf1)).To(Equal("first\n"))
+
+		time.Sleep(100 * time.Millisecond)
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+
+		conn2, buf2 := accept(spySink)
+		defer conn2.Close()
+		Expect(readBody(conn2, buf2)).To(Equal("second\n"))
+		_, err := readBody(conn1, buf1)
+		Expect(err).To(Equal(io.EOF))
+		Expect(s.MessagesDropped()).To(BeZero())
+	})
+
+	It("keeps using a connection younger than its maximum age", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:             spySink.url(),
+			Namespace:        "ns1",
+			MaxConnectionAge: time.Hour,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("first\n", "second\n")
+	})
+
+	It("closes idle connections", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:        spySink.url(),
+			Namespace:   "ns1",
+			IdleTimeout: 100 * time.Millisecond,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		conn1, buf1 := accept(spySink)
+		defer conn1.Close()
+		Expect(readBody(conn1, buf1)).To(Equal("first\n"))
+
+		start := time.Now()
+		_, err := readBody(conn1, buf1)
+		Expect(err).To(Equal(io.EOF))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+
+		conn2, buf2 := accept(spySink)
+		defer conn2.Close()
+		Expect(readBody(conn2, buf2)).To(Equal("second\n"))
+		Expect(s.MessagesDropped()).To(BeZero())
+		Expect(out.SinkState()[0].Error).To(BeNil())
+	})
+
+	It("reconnects when the receiver closes the connection", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:      spySink.url(),
+			Namespace: "ns1",
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		conn1, buf1 := accept(spySink)
+		Expect(readBody(conn1, buf1)).To(Equal("first\n"))
+		Expect(out.SinkState()[0].Connected).To(BeTrue())
+		Expect(conn1.Close()).To(Succeed())
+
+		Eventually(func() bool {
+			return out.SinkState()[0].Connected
+		}).Should(BeFalse())
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+
+		conn2, buf2 := accept(spySink)
+		defer conn2.Close()
+		Expect(readBody(conn2, buf2)).To(Equal("second\n"))
+		Expect(s.MessagesDropped()).To(BeZero())
+	})
+
+	It("reconnects when the receiver resets the connection", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:      spySink.url(),
+			Namespace: "ns1",
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		conn1, buf1 := accept(spySink)
+		Expect(readBody(conn1, buf1)).To(Equal("first\n"))
+		Expect(conn1.(*net.TCPConn).SetLinger(0)).To(Succeed())
+		Expect(conn1.Close()).To(Succeed())
+
+		Eventually(func() bool {
+			return out.SinkState()[0].Connected
+		}).Should(BeFalse())
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("third"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("second\n", "third\n")
+		Expect(s.MessagesDropped()).To(BeZero())
+		Expect(out.SinkState()[0].Error).To(BeNil())
+	})
+})
@@ -0,0 +1,300 @@
+package syslog
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+const (
+	defaultMetadataCacheSize = 4096
+	maxCachedHostnames       = 1024
+)
+
+// podMetadata is what convert derives from the kubernetes metadata of a
+// container's records. It is shared by all messages of the container and
+// must not be modified.
+type podMetadata struct {
+	namespace string
+	pod       string
+	container string
+	vmID      string
+	prefix    string
+	labels    map[string]string
+
+	appName        string
+	structuredData []rfc5424.StructuredData
+}
+
+func newPodMetadata(
+	ns, pod, container, vmID, prefix string,
+	labels map[interface{}]interface{},
+	hasKubernetes bool,
+) *podMetadata {
+	labelParams := processLabels(labels)
+	m := &podMetadata{
+		namespace: ns,
+		pod:       pod,
+		container: container,
+		vmID:      vmID,
+		prefix:    prefix,
+		labels:    make(map[string]string, len(labelParams)),
+		// The slice is full so that appending to it copies it.
+		structuredData: []rfc5424.StructuredData{
+			buildStructuredData(labelParams, ns, pod, container, vmID),
+		},
+	}
+	for _, p := range labelParams {
+		m.labels[p.Name] = p.Value
+	}
+
+	if hasKubernetes {
+		m.appName = prefix + "/" + ns + "/" + pod + "/" + container
+		// APP-NAME is limited to 48 chars in RFC 5424
+		// https://tools.ietf.org/html/rfc5424#section-6
+		if len(m.appName) > 48 {
+			m.appName = m.appName[:48]
+		}
+	}
+	return m
+}
+
+// matches reports whether m was derived from the given metadata. It does
+// not allocate.
+func (m *podMetadata) matches(
+	ns, pod, container, vmID []byte,
+	prefix string,
+	labels map[interface{}]interface{},
+) bool {
+	if m.namespace != string(ns) || m.pod != string(pod) ||
+		m.container != string(container) || m.vmID != string(vmID) ||
+		m.prefix != prefix {
+		return false
+	}
+
+	var n int
+	for k, v := range labels {
+		ks, ok := k.(string)
+		if !ok {
+			continue
+		}
+		vb, ok := v.([]byte)
+		if !ok {
+			continue
+		}
+		if cached, ok := m.labels[ks]; !ok || cached != string(vb) {
+			return false
+		}
+		n++
+	}
+	return n == len(m.labels)
+}
+
+// MetadataCacheStats reports how often the metadata of a record's container
+// was found in the cache.
+type MetadataCacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Size      int   `json:"size"`
+}
+
+// HitRate returns the share of lookups that were served from the cache.
+func (s MetadataCacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// WithMetadataCache limits the cache of container metadata to size
+// containers, evicting the least recently used, and rebuilds cached metadata
+// once it is older than ttl. A ttl of zero keeps metadata until it is
+// evicted. By default 4096 containers are cached without a ttl.
+func WithMetadataCache(size int, ttl time.Duration) OutOption {
+	return func(o *Out) {
+		o.metadataCacheSize = size
+		o.metadataCacheTTL = ttl
+	}
+}
+
+// MetadataCacheStats returns the statistics of the container metadata cache.
+func (o *Out) MetadataCacheStats() MetadataCacheStats {
+	return o.metadata.stats()
+}
+
+type metadataEntry struct {
+	key     uint64
+	meta    *podMetadata
+	created time.Time
+}
+
+// metadataCache holds the metadata of recently seen containers, keyed by a
+// hash of their namespace, pod and container names and labels, and the
+// hostnames derived from node and cluster names. Containers are evicted
+// least recently used first, the hostnames map is cleared once it is full.
+type metadataCache struct {
+	sanitizeHost bool
+	size         int
+	ttl          time.Duration
+
+	mu        sync.Mutex
+	lru       *list.List
+	entries   map[uint64]*list.Element
+	hostnames map[string]string
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+func newMetadataCache(sanitizeHost bool, size int, ttl time.Duration) *metadataCache {
+	if size <= 0 {
+		size = defaultMetadataCacheSize
+	}
+	return &metadataCache{
+		sanitizeHost: sanitizeHost,
+		size:         size,
+		ttl:          ttl,
+		lru:          list.New(),
+		entries:      make(map[uint64]*list.Element),
+		hostnames:    make(map[string]string),
+	}
+}
+
+// metadata returns the metadata of a container, reusing the cached metadata
+// if it still matches.
+func (c *metadataCache) metadata(
+	ns, pod, container, vmID []byte,
+	prefix string,
+	labels map[interface{}]interface{},
+) *podMetadata {
+	key := metadataKey(ns, pod, container, vmID, prefix, labels)
+	var now time.Time
+	if c.ttl > 0 {
+		now = time.Now()
+	}
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*metadataEntry)
+		if (c.ttl <= 0 || now.Sub(entry.created) < c.ttl) &&
+			entry.meta.matches(ns, pod, container, vmID, prefix, labels) {
+			c.lru.MoveToFront(e)
+			c.hits++
+			c.mu.Unlock()
+			return entry.meta
+		}
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	m := newPodMetadata(string(ns), string(pod), string(container), string(vmID), prefix, labels, true)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value = &metadataEntry{key: key, meta: m, created: now}
+		c.lru.MoveToFront(e)
+		return m
+	}
+	c.entries[key] = c.lru.PushFront(&metadataEntry{key: key, meta: m, created: now})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*metadataEntry).key)
+		c.evictions++
+	}
+	return m
+}
+
+func (c *metadataCache) stats() MetadataCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return MetadataCacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Size:      c.lru.Len(),
+	}
+}
+
+// metadataKey hashes the identity of a container with FNV-1a without
+// converting it to strings. Labels are hashed independently of their order.
+// Entries with the same key are compared in full, so collisions only cost a
+// rebuild.
+func metadataKey(
+	ns, pod, container, vmID []byte,
+	prefix string,
+	labels map[interface{}]interface{},
+) uint64 {
+	h := uint64(fnvOffset64)
+	for _, part := range [][]byte{ns, pod, container, vmID} {
+		h = fnv64(h, part)
+		h = (h ^ '/') * fnvPrime64
+	}
+	for i := 0; i < len(prefix); i++ {
+		h = (h ^ uint64(prefix[i])) * fnvPrime64
+	}
+
+	var labelHash uint64
+	for k, v := range labels {
+		ks, ok := k.(string)
+		if !ok {
+			continue
+		}
+		vb, ok := v.([]byte)
+		if !ok {
+			continue
+		}
+		lh := uint64(fnvOffset64)
+		for i := 0; i < len(ks); i++ {
+			lh = (lh ^ uint64(ks[i])) * fnvPrime64
+		}
+		lh = (lh ^ '=') * fnvPrime64
+		labelHash += fnv64(lh, vb)
+	}
+	return (h ^ labelHash) * fnvPrime64
+}
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+func fnv64(h uint64, b []byte) uint64 {
+	for _, c := range b {
+		h = (h ^ uint64(c)) * fnvPrime64
+	}
+	return h
+}
+
+// hostname returns the HOSTNAME of messages for the given node or cluster
+// name, sanitized if configured.
+func (c *metadataCache) hostname(name []byte) string {
+	if len(name) == 0 {
+		return ""
+	}
+
+	c.mu.Lock()
+	host, ok := c.hostnames[string(name)]
+	c.mu.Unlock()
+	if ok {
+		return host
+	}
+
+	host = string(name)
+	if c.sanitizeHost {
+		host = sanitizeHostname(host)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.hostnames) >= maxCachedHostnames {
+		c.hostnames = make(map[string]string)
+	}
+	c.hostnames[string(name)] = host
+	return host
+}
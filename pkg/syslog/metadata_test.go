@@ -0,0 +1,86 @@
+package syslog_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Metadata cache", func() {
+	record := func(pod, version string) map[interface{}]interface{} {
+		return map[interface{}]interface{}{
+			"log": []byte("some-log"),
+			"kubernetes": map[interface{}]interface{}{
+				"labels": map[interface{}]interface{}{
+					"app":     []byte("some-app"),
+					"version": []byte(version),
+				},
+				"pod_name":       []byte(pod),
+				"namespace_name": []byte("ns1"),
+				"container_name": []byte("container-name"),
+			},
+		}
+	}
+
+	It("reuses the metadata of a container", func() {
+		out := syslog.NewOut(nil, nil)
+
+		for i := 0; i < 4; i++ {
+			out.Write(record("pod-a", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+		}
+		out.Write(record("pod-b", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+
+		stats := out.MetadataCacheStats()
+		Expect(stats.Hits).To(Equal(int64(3)))
+		Expect(stats.Misses).To(Equal(int64(2)))
+		Expect(stats.Size).To(Equal(2))
+		Expect(stats.HitRate()).To(BeNumerically("~", 0.6))
+	})
+
+	It("rebuilds the metadata when labels change", func() {
+		out := syslog.NewOut(nil, nil)
+
+		out.Write(record("pod-a", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("pod-a", "v2"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("pod-a", "v2"), time.Unix(0, 0).UTC(), "pod.log")
+
+		stats := out.MetadataCacheStats()
+		Expect(stats.Hits).To(Equal(int64(1)))
+		Expect(stats.Misses).To(Equal(int64(2)))
+	})
+
+	It("evicts the least recently used container", func() {
+		out := syslog.NewOut(nil, nil, syslog.WithMetadataCache(2, 0))
+
+		out.Write(record("pod-a", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("pod-b", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("pod-a", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("pod-c", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+
+		stats := out.MetadataCacheStats()
+		Expect(stats.Evictions).To(Equal(int64(1)))
+		Expect(stats.Size).To(Equal(2))
+
+		out.Write(record("pod-a", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+		Expect(out.MetadataCacheStats().Hits).To(Equal(int64(2)))
+		out.Write(record("pod-b", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+		Expect(out.MetadataCacheStats().Misses).To(Equal(int64(4)))
+	})
+
+	It("rebuilds metadata older than the ttl", func() {
+		out := syslog.NewOut(nil, nil, syslog.WithMetadataCache(0, 50*time.Millisecond))
+
+		out.Write(record("pod-a", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("pod-a", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+		time.Sleep(100 * time.Millisecond)
+		out.Write(record("pod-a", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+
+		stats := out.MetadataCacheStats()
+		Expect(stats.Hits).To(Equal(int64(1)))
+		Expect(stats.Misses).To(Equal(int64(2)))
+		Expect(stats.Size).To(Equal(1))
+	})
+})
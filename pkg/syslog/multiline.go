@@ -0,0 +1,155 @@
+package syslog
+
+import (
+	"bytes"
+	"regexp"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+const (
+	defaultMultilineFlushTimeout = time.Second
+	defaultMultilineMaxLines     = 500
+
+	// MinMultilineFlushTimeout is the shortest FlushTimeout. Shorter
+	// timeouts are raised to it, as pending events are checked every half
+	// timeout.
+	MinMultilineFlushTimeout = 10 * time.Millisecond
+)
+
+// Multiline configures the reassembly of log lines that belong to a single
+// log event, e.g. stack traces, into one syslog message.
+type Multiline struct {
+	// StartPatterns match the first line of a log event. Lines that do not
+	// match any of them are appended to the previous line of the same
+	// container.
+	StartPatterns []*regexp.Regexp
+	// FlushTimeout is how long a log event is held waiting for further
+	// lines before it is sent. Defaults to one second and is at least
+	// MinMultilineFlushTimeout.
+	FlushTimeout time.Duration
+	// MaxLines is the maximum number of lines merged into a single
+	// message. Defaults to 500.
+	MaxLines int
+}
+
+// WithMultiline configures the reassembly of multiline log events per
+// container before they are routed to sinks.
+func WithMultiline(m Multiline) OutOption {
+	return func(o *Out) {
+		if len(m.StartPatterns) == 0 {
+			o.multiline = nil
+			return
+		}
+		if m.FlushTimeout <= 0 {
+			m.FlushTimeout = defaultMultilineFlushTimeout
+		}
+		if m.FlushTimeout < MinMultilineFlushTimeout {
+			m.FlushTimeout = MinMultilineFlushTimeout
+		}
+		if m.MaxLines <= 0 {
+			m.MaxLines = defaultMultilineMaxLines
+		}
+		o.multiline = &multiline{
+			config:  m,
+			pending: make(map[source]*pendingEvent),
+		}
+	}
+}
+
+type pendingEvent struct {
+	msg     *rfc5424.Message
+	lines   int
+	updated time.Time
+}
+
+// multiline holds the log event currently being assembled for every
+// container.
+type multiline struct {
+	config Multiline
+	route  func(*rfc5424.Message, source)
+
+	mu      sync.Mutex
+	pending map[source]*pendingEvent
+}
+
+// start begins flushing log events that have not received further lines
+// within the flush timeout.
+func (m *multiline) start(route func(*rfc5424.Message, source)) {
+	m.route = route
+
+	interval := m.config.FlushTimeout / 2
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for now := range t.C {
+			m.flushExpired(now)
+		}
+	}()
+}
+
+// add either appends msg to the pending log event of its container or
+// flushes the pending event and starts a new one.
+func (m *multiline) add(msg *rfc5424.Message, src source) {
+	if src == (source{}) {
+		m.route(msg, src)
+		return
+	}
+
+	// Routing happens while holding the lock so that log events of a
+	// container are never reordered by a concurrent flush.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.pending[src]
+	if ok && !m.isStart(msg.Message) && p.lines < m.config.MaxLines {
+		if p.lines == 1 {
+			// The first line may share its backing array with the record
+			// it was converted from, so it is copied before appending.
+			p.msg.Message = append([]byte(nil), p.msg.Message...)
+		}
+		p.msg.Message = append(p.msg.Message, msg.Message...)
+		p.lines++
+		p.updated = time.Now()
+		return
+	}
+
+	if ok {
+		m.route(p.msg, src)
+	}
+	m.pending[src] = &pendingEvent{
+		msg:     msg,
+		lines:   1,
+		updated: time.Now(),
+	}
+}
+
+// flush sends all pending log events regardless of their age.
+func (m *multiline) flush() {
+	m.flushExpired(time.Time{})
+}
+
+func (m *multiline) flushExpired(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for src, p := range m.pending {
+		if !now.IsZero() && now.Sub(p.updated) < m.config.FlushTimeout {
+			continue
+		}
+		m.route(p.msg, src)
+		delete(m.pending, src)
+	}
+}
+
+func (m *multiline) isStart(line []byte) bool {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	for _, p := range m.config.StartPatterns {
+		if p.Match(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package syslog_test
+
+import (
+	"bufio"
+	"regexp"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Multiline", func() {
+	newOut := func(addr string) *syslog.Out {
+		s := &syslog.Sink{
+			Addr:      addr,
+			Namespace: "ns1",
+		}
+		return syslog.NewOut(
+			[]*syslog.Sink{s},
+			nil,
+			syslog.WithMultiline(syslog.Multiline{
+				StartPatterns: []*regexp.Regexp{regexp.MustCompile(`^\S`)},
+				FlushTimeout:  100 * time.Millisecond,
+			}),
+		)
+	}
+
+	It("merges continuation lines into a single message", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		out := newOut(spySink.url())
+
+		out.Write(record("Exception in thread main\n"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("\tat Foo.bar(Foo.java:1)\n"), time.Unix(1, 0).UTC(), "pod.log")
+		out.Write(record("\tat Foo.main(Foo.java:2)\n"), time.Unix(2, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedFrames(
+			`<14>1 1970-01-01T00:00:00+00:00 - pod.log/ns1/pod-name/container-name - - [kubernetes@47450 namespace_name="ns1" object_name="pod-name" container_name="container-name"] Exception in thread main` + "\n" +
+				"\tat Foo.bar(Foo.java:1)\n" +
+				"\tat Foo.main(Foo.java:2)\n",
+		)
+	})
+
+	It("sends the pending event when a new event starts", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		out := newOut(spySink.url())
+
+		out.Write(record("first\n"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record(" continued\n"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("second\n"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Flush(time.Second)
+
+		spySink.expectReceivedFrames(
+			`<14>1 1970-01-01T00:00:00+00:00 - pod.log/ns1/pod-name/container-name - - [kubernetes@47450 namespace_name="ns1" object_name="pod-name" container_name="container-name"] first`+"\n continued\n",
+			`<14>1 1970-01-01T00:00:00+00:00 - pod.log/ns1/pod-name/container-name - - [kubernetes@47450 namespace_name="ns1" object_name="pod-name" container_name="container-name"] second`+"\n",
+		)
+	})
+
+	It("keeps lines of different containers apart", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		out := newOut(spySink.url())
+
+		out.Write(podRecord("ns1", "pod-1", "first\n"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(podRecord("ns1", "pod-2", "second\n"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(podRecord("ns1", "pod-2", " continued\n"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(podRecord("ns1", "pod-1", " continued\n"), time.Unix(0, 0).UTC(), "pod.log")
+
+		conn := spySink.accept()
+		defer conn.Close()
+		buf := bufio.NewReader(conn)
+
+		bodies := make(map[string]string)
+		for len(bodies) < 2 {
+			var msg rfc5424.Message
+			_, err := msg.ReadFrom(buf)
+			Expect(err).ToNot(HaveOccurred())
+			bodies[msg.AppName] = string(msg.Message)
+		}
+
+		Expect(bodies).To(Equal(map[string]string{
+			"pod.log/ns1/pod-1/container-name": "first\n continued\n",
+			"pod.log/ns1/pod-2/container-name": "second\n continued\n",
+		}))
+	})
+
+	It("raises flush timeouts below the minimum", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:      spySink.url(),
+			Namespace: "ns1",
+		}
+		out := syslog.NewOut(
+			[]*syslog.Sink{s},
+			nil,
+			syslog.WithMultiline(syslog.Multiline{
+				StartPatterns: []*regexp.Regexp{regexp.MustCompile(`^\S`)},
+				FlushTimeout:  time.Nanosecond,
+			}),
+		)
+
+		out.Write(record("some-log\n"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("some-log\n")
+	})
+})
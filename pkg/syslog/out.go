@@ -27,6 +27,13 @@ const (
 
 var invalidHostnameCharacter = regexp.MustCompile(`[^a-z0-9-]`)
 
+// source identifies the kubernetes container a record originated from.
+type source struct {
+	namespace string
+	pod       string
+	container string
+}
+
 type SinkError struct {
 	Msg       string    `json:"msg"`
 	Timestamp time.Time `json:"timestamp"`
@@ -37,24 +44,164 @@ type SinkState struct {
 	Namespace          string     `json:"namespace"`
 	LastSuccessfulSend time.Time  `json:"last_successful_send"`
 	Error              *SinkError `json:"error"`
+	// NamespaceDrops holds the messages dropped per source namespace by
+	// cluster sinks. Drops of namespaces beyond the first 1000 that had
+	// drops are counted under "(other)".
+	NamespaceDrops map[string]int64 `json:"namespace_drops,omitempty"`
+	// Backoff is set while the sink is backing off after failed writes.
+	Backoff *BackoffState `json:"backoff,omitempty"`
+	// CircuitBreaker is the state of the sink's circuit breaker if it has
+	// one.
+	CircuitBreaker string `json:"circuit_breaker,omitempty"`
+	// ActiveAddr is the address the sink currently sends to.
+	ActiveAddr string `json:"active_addr,omitempty"`
+	// Connected reports whether the sink holds a connection that the
+	// receiver has not closed. HTTPS drains do not hold connections.
+	Connected bool `json:"connected"`
+	// Unacked is the number of messages a RELP sink is waiting to have
+	// acknowledged.
+	Unacked int `json:"unacked,omitempty"`
+	// Pool holds the state of each connection of a balancing sink.
+	Pool []SinkState `json:"pool,omitempty"`
 }
 
 type Sink struct {
+	// Addr is the host and port of the receiver, the path of a unix domain
+	// socket prefixed with unix:// (stream) or unixgram:// (datagram), or
+	// the URL of an HTTPS drain.
 	Addr      string
 	Name      string
 	Namespace string
 	TLS       *TLS
 
-	messages chan io.WriterTo
-
+	// Protocol is the transport used to send messages, with or without
+	// TLS. RELPWindow is the number of messages a RELP sink sends before
+	// waiting for acknowledgements and defaults to 128.
+	Protocol   Protocol
+	RELPWindow int
+
+	// HTTP configures sinks whose Addr is an https:// URL. Such sinks POST
+	// batches of messages to the URL instead of holding a connection and
+	// retry failed requests five times unless Retry is set.
+	HTTP *HTTPDrain
+
+	// FailoverAddrs are tried in order when Addr can not be reached. The
+	// sink fails back to a preferred address once it is reachable again,
+	// checking every FailbackInterval (default one minute).
+	FailoverAddrs    []string
+	FailbackInterval time.Duration
+
+	// SRV is a domain whose _syslog._tcp SRV records are used instead of
+	// Addr, in order of priority.
+	SRV string
+
+	// ResolveInterval makes the sink resolve its addresses again
+	// periodically. A sink whose addresses resolve differently reconnects
+	// and a balancing sink updates its pool.
+	ResolveInterval time.Duration
+
+	// BalanceAddrs makes the sink hold a connection to each address, to
+	// each A and AAAA record of the host in BalanceHost and of the targets
+	// of the _syslog._tcp SRV records of BalanceSRV, and distribute messages
+	// across them according to BalancePolicy. Addr, SRV and FailoverAddrs
+	// are not used by balancing sinks.
+	BalanceAddrs  []string
+	BalanceHost   string
+	BalanceSRV    string
+	BalancePolicy BalancePolicy
+
+	// MaxMessageSize is the maximum size in bytes of a serialized syslog
+	// message. Larger messages are handled according to SizePolicy. Zero
+	// means no limit.
+	MaxMessageSize int
+	SizePolicy     SizePolicy
+
+	// Redaction rules are applied to messages written to this sink only.
+	Redaction []RedactionRule
+
+	// RateLimit limits all messages sent to the sink whereas
+	// NamespaceRateLimit limits the messages of each source namespace
+	// separately.
+	RateLimit          *RateLimit
+	NamespaceRateLimit *RateLimit
+
+	// NamespaceWeights determines how many messages of a namespace a
+	// cluster sink sends in turn before moving on to the next namespace.
+	// Namespaces default to a weight of one.
+	NamespaceWeights map[string]int
+
+	// QueueSize overrides the queue size configured via WithBufferSize for
+	// this sink. OverflowPolicy determines what happens to messages when the
+	// queue is full; OverflowTimeout is how long OverflowBlock waits for
+	// room and defaults to 100ms.
+	QueueSize       int
+	OverflowPolicy  OverflowPolicy
+	OverflowTimeout time.Duration
+
+	// Retry configures retries of failed writes. Without it messages that
+	// fail to be written are dropped.
+	Retry *RetryPolicy
+
+	// CircuitBreaker stops the sink from dialing and writing after
+	// repeated failures.
+	CircuitBreaker *CircuitBreaker
+
+	// MaxConnectionAge makes the sink reconnect before writing to a
+	// connection older than that, so that connections through L4 load
+	// balancers are spread over time. IdleTimeout closes connections that
+	// have not been written to for that long. KeepAlive is the TCP
+	// keepalive interval; zero uses the Go default and a negative value
+	// disables keepalives.
+	MaxConnectionAge time.Duration
+	IdleTimeout      time.Duration
+	KeepAlive        time.Duration
+
+	// WriteBufferSize makes the sink coalesce messages into a buffer of
+	// that many bytes that is written to the connection at once. Buffered
+	// messages are written once the buffer is full or after waiting
+	// WriteLinger (default 10ms) for more messages. Zero writes every
+	// message on its own. RELP sinks and HTTPS drains do not use it.
+	WriteBufferSize int
+	WriteLinger     time.Duration
+
+	messages queue
+	// unfinished counts the messages queued on the sink or being written
+	// by it.
+	unfinished int64
+
+	messagesSent         int64
 	messagesDropped      int64
+	messagesOversized    int64
+	messagesSuppressed   int64
+	messagesRetried      int64
+	messagesResent       int64
+	redactor             *redactor
+	limiter              *rateLimiter
+	retry                *RetryPolicy
+	backoff              *backoff
+	breaker              *circuitBreaker
 	lastSendSuccessNanos int64
 	lastSendAttemptNanos int64
 	writeErr             atomic.Value
-
-	conn               net.Conn
-	writeTimeout       time.Duration
-	maintainConnection func() error
+	// connWatch publishes connClosed, or nil without a connection, for
+	// SinkState.
+	connWatch atomic.Value
+
+	conn         net.Conn
+	connClosed   *int32
+	connectedAt  time.Time
+	idleTimer    *time.Timer
+	writeTimeout time.Duration
+	dial         func(addr string) (net.Conn, error)
+	serverName   string
+	failover     *failover
+	rotation     *rotation
+	relp         *relpClient
+	http         *httpDrain
+	batch        *writeBatch
+	pool         *pool
+	// exited is closed once the sink's goroutine has returned.
+	exited chan struct{}
 }
 
 type TLS struct {
@@ -70,6 +217,17 @@ type Out struct {
 	bufferSize   int
 	writeTimeout time.Duration
 	sanitizeHost bool
+	multiline    *multiline
+	redactor     *redactor
+	resolver     Resolver
+	metadata     *metadataCache
+	converters   *converters
+
+	conversionWorkers int
+	metadataCacheSize int
+	metadataCacheTTL  time.Duration
+
+	suppressionReportInterval time.Duration
 }
 
 // OutOption is the optional setting of write output.
@@ -110,223 +268,568 @@ func NewOut(sinks, clusterSinks []*Sink, opts ...OutOption) *Out {
 		dialTimeout:  5 * time.Second,
 		bufferSize:   10000,
 		writeTimeout: time.Second,
+		resolver:     net.DefaultResolver,
+
+		suppressionReportInterval: defaultSuppressionReportInterval,
 	}
 
 	for _, o := range opts {
 		o(out)
 	}
+	out.metadata = newMetadataCache(out.sanitizeHost, out.metadataCacheSize, out.metadataCacheTTL)
+	if out.multiline != nil {
+		out.multiline.start(out.route)
+	}
 
 	m := make(map[string][]*Sink)
 	for _, s := range sinks {
-		if s.TLS != nil {
-			s.maintainConnection = tlsMaintainConn(s, out)
-		} else {
-			s.maintainConnection = tcpMaintainConn(s, out)
-		}
-
 		m[s.Namespace] = append(m[s.Namespace], s)
-		s.writeTimeout = out.writeTimeout
-		s.start(out.bufferSize)
+		out.initSink(s, func() queue {
+			return newChanQueue(out.queueSize(s), s.overflow())
+		})
 	}
 	for _, s := range clusterSinks {
-		if s.TLS != nil {
-			s.maintainConnection = tlsMaintainConn(s, out)
-		} else {
-			s.maintainConnection = tcpMaintainConn(s, out)
-		}
-		s.writeTimeout = out.writeTimeout
-		s.start(out.bufferSize)
+		// Cluster sinks receive messages of all namespaces and queue them
+		// per namespace so that one namespace can not starve the others.
+		// The namespaces share the sink's queue size.
+		out.initSink(s, func() queue {
+			return newFairQueue(out.queueSize(s), s.NamespaceWeights, s.overflow())
+		})
 	}
 	out.sinks = m
 	out.clusterSinks = clusterSinks
+	if out.conversionWorkers > 1 {
+		out.converters = out.startConverters(out.conversionWorkers)
+	}
 	return out
 }
 
-// Write takes a record, timestamp, and tag, converts it into a syslog message
-// and routes it to the connections with the matching namespace.
-// Each sink has it's own backing network connection and queue. The queue's
-// size is fixed to 10000 messages. It will report dropped messages via a log
-// for every 1000 messages dropped.
-// If no connection is established one will be established per sink upon a
-// Write operation. Write will also write all messages to all cluster sinks
-// provided.
+func (o *Out) queueSize(s *Sink) int {
+	if s.QueueSize > 0 {
+		return s.QueueSize
+	}
+	return o.bufferSize
+}
+
+func (s *Sink) overflow() overflow {
+	o := overflow{
+		policy:  s.OverflowPolicy,
+		timeout: s.OverflowTimeout,
+	}
+	if o.timeout <= 0 {
+		o.timeout = defaultOverflowTimeout
+	}
+	return o
+}
+
+// initSink applies the configuration of o and s to s and starts processing
+// its messages. Balancing sinks start a member sink with a queue from
+// newQueue for each address.
+func (o *Out) initSink(s *Sink, newQueue func() queue) {
+	s.redactor = newRedactor(s.Redaction)
+	s.limiter = newRateLimiter(s.RateLimit, s.NamespaceRateLimit)
+	if s.balances() {
+		eps, err := o.balanceEndpoints(s)
+		if err != nil {
+			log.Printf("[out_syslog] Unable to resolve addresses of sink %s: %s\n", s.Name, err)
+		}
+		s.pool = o.newPool(s, eps, newQueue)
+		o.startPoolResolution(s)
+	} else {
+		// If the SRV records can not be looked up they are looked up
+		// again on the next connection attempt.
+		var lookup func() ([]string, error)
+		addrs, err := o.sinkAddrs(s)
+		if err != nil {
+			log.Printf("[out_syslog] Unable to look up SRV records of sink %s: %s\n", s.Name, err)
+			lookup = func() ([]string, error) {
+				return o.sinkAddrs(s)
+			}
+		}
+		s.messages = newQueue()
+		s.rotation = o.newRotation(s)
+		o.startSink(s, addrs, lookup)
+	}
+	s.startSuppressionReports(o.suppressionReportInterval)
+}
+
+// startSink sets up the connection handling of s for the given addresses
+// and starts writing the messages of its queue. A non-nil lookup replaces
+// the addresses before the next connection attempt once it succeeds.
+func (o *Out) startSink(s *Sink, addrs []string, lookup func() ([]string, error)) {
+	s.retry = s.Retry
+	if isHTTPAddr(s.Addr) {
+		s.http = o.newHTTPDrain(s)
+		if s.retry == nil {
+			s.retry = &RetryPolicy{}
+		}
+	}
+	if s.TLS != nil {
+		s.dial = tlsDial(s, o)
+	} else {
+		s.dial = tcpDial(s, o)
+	}
+	if s.Protocol == ProtocolRELP {
+		s.relp = newRELPClient(s)
+		s.dial = s.relp.dial(s.dial, o.dialTimeout)
+	}
+	if s.relp == nil && s.http == nil {
+		s.batch = newWriteBatch(s)
+	}
+	s.failover = newFailover(addrs, s.FailbackInterval, lookup)
+	s.backoff = newBackoff(s.retry)
+	s.breaker = newCircuitBreaker(s.CircuitBreaker)
+	s.writeTimeout = o.writeTimeout
+	s.start()
+}
+
+// Write takes a record, timestamp, and tag, converts it into a syslog
+// message and routes it to the connections with the matching namespace. Each
+// sink has its own backing network connection and queue. The queue's size
+// defaults to 10000 messages and can be set per sink, as can the policy
+// applied when it is full. Cluster sinks share a queue of that size between
+// per source namespace queues which are drained round robin. It will report
+// dropped messages via a log for every 1000 messages dropped. If no
+// connection is established one will be established per sink upon a Write
+// operation. Write will also write all messages to all cluster sinks
+// provided. With conversion workers the record is converted asynchronously;
+// see Wait.
 func (o *Out) Write(
 	record map[interface{}]interface{},
 	ts time.Time,
 	tag string,
 ) {
-	msg, namespace := convert(record, ts, tag, o.sanitizeHost)
+	if o.converters != nil {
+		o.converters.dispatch(record, ts, tag)
+		return
+	}
+	o.write(record, ts, tag)
+}
 
+// Wait blocks until all records passed to Write have been converted and
+// queued on their sinks. It returns right away unless conversion workers
+// are configured.
+func (o *Out) Wait() {
+	o.converters.wait()
+}
+
+func (o *Out) write(
+	record map[interface{}]interface{},
+	ts time.Time,
+	tag string,
+) {
+	msg, src := convert(record, ts, tag, o.metadata)
+	msg = o.redactor.redact(msg)
+	if o.multiline != nil {
+		o.multiline.add(msg, src)
+		return
+	}
+	o.route(msg, src)
+}
+
+// route queues msg on all cluster sinks and on the sinks of the namespace
+// it originated from. The sinks share a single serialization of msg.
+func (o *Out) route(msg *rfc5424.Message, src source) {
+	enc := newEncodedMessage(msg)
 	for _, cs := range o.clusterSinks {
-		cs.queueMessage(msg)
+		cs.queueMessage(enc, src)
 	}
 
-	namespaceSinks, ok := o.sinks[namespace]
+	namespaceSinks, ok := o.sinks[src.namespace]
 	if !ok {
 		// TODO: track ignored messages
 		return
 	}
 
 	for _, s := range namespaceSinks {
-		s.queueMessage(msg)
+		s.queueMessage(enc, src)
+	}
+}
+
+// Flush waits for records that are still being converted, routes all log
+// events that are still being assembled from multiline records to their
+// sinks and waits up to timeout for the sinks to write or drop all queued
+// and buffered messages. Buffered messages are written once their linger
+// time or batch age has passed. It reports whether the sinks finished in
+// time.
+func (o *Out) Flush(timeout time.Duration) bool {
+	o.Wait()
+	if o.multiline != nil {
+		o.multiline.flush()
+	}
+
+	deadline := time.Now().Add(timeout)
+	for !o.idle() {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
+	return true
+}
+
+// idle reports whether no sink has messages left to write.
+func (o *Out) idle() bool {
+	for _, sinks := range o.sinks {
+		for _, s := range sinks {
+			if !s.idle() {
+				return false
+			}
+		}
+	}
+	for _, s := range o.clusterSinks {
+		if !s.idle() {
+			return false
+		}
+	}
+	return true
+}
+
+// idle reports whether the sink has written or dropped all messages queued
+// on it and the RELP receiver acknowledged them. Messages move to the write
+// batch, HTTPS drain or RELP window before they stop being unfinished, so
+// those are checked last.
+func (s *Sink) idle() bool {
+	if s.pool != nil {
+		return s.pool.idle()
+	}
+	return atomic.LoadInt64(&s.unfinished) == 0 && !s.batch.buffered() && !s.http.buffered() &&
+		s.relp.unackedCount() == 0
 }
 
 func (o *Out) SinkState() []SinkState {
 	var stats []SinkState
 	for _, sinks := range o.sinks {
 		for _, s := range sinks {
-			stats = append(stats, SinkState{
-				Name:               s.Name,
-				Namespace:          s.Namespace,
-				LastSuccessfulSend: time.Unix(0, atomic.LoadInt64(&s.lastSendSuccessNanos)),
-				Error:              s.LoadSinkError(),
-			})
+			stats = append(stats, s.state())
 		}
 	}
 
 	for _, s := range o.clusterSinks {
-		stats = append(stats, SinkState{
-			Name:               s.Name,
-			LastSuccessfulSend: time.Unix(0, atomic.LoadInt64(&s.lastSendSuccessNanos)),
-			Error:              s.LoadSinkError(),
-		})
+		state := s.state()
+		state.Namespace = ""
+		stats = append(stats, state)
 	}
 
 	return stats
 }
 
+func (s *Sink) state() SinkState {
+	if s.pool != nil {
+		state := SinkState{
+			Name:      s.Name,
+			Namespace: s.Namespace,
+		}
+		s.pool.state(&state)
+		return state
+	}
+
+	state := SinkState{
+		Name:               s.Name,
+		Namespace:          s.Namespace,
+		LastSuccessfulSend: time.Unix(0, atomic.LoadInt64(&s.lastSendSuccessNanos)),
+		Error:              s.LoadSinkError(),
+		Backoff:            s.backoff.load(),
+		CircuitBreaker:     s.breaker.load(),
+		ActiveAddr:         RedactAddr(s.failover.load()),
+		Connected:          s.connected(),
+		Unacked:            s.relp.unackedCount(),
+	}
+	if q, ok := s.messages.(*fairQueue); ok {
+		state.NamespaceDrops = q.drops()
+	}
+	return state
+}
+
 func (s *Sink) LoadSinkError() *SinkError {
+	if s.pool != nil {
+		var state SinkState
+		s.pool.state(&state)
+		return state.Error
+	}
 	if sinkError, ok := s.writeErr.Load().(SinkError); ok && sinkError.Msg != "" {
 		return &sinkError
 	}
 	return nil
 }
 
-func (s *Sink) start(bufferSize int) {
-	s.messages = make(chan io.WriterTo, bufferSize)
+func (s *Sink) start() {
+	s.exited = make(chan struct{})
 	go func() {
-		for m := range s.messages {
-			s.write(m)
+		defer close(s.exited)
+		for {
+			m := s.next()
+			if m == nil {
+				// The queue was closed as the sink left its pool.
+				s.flush()
+				s.http.close()
+				s.closeConn()
+				return
+			}
+			if msg, ok := rfc5424Message(m); ok {
+				// Redacted messages are copies that this sink
+				// serializes on its own.
+				if redacted := s.redactor.redact(msg); redacted != msg {
+					m = newEncodedMessage(redacted)
+				}
+			}
+			for _, w := range s.enforceSize(m) {
+				switch {
+				case s.http != nil:
+					s.http.add(w)
+				case s.batch != nil:
+					s.buffer(w)
+				default:
+					s.deliver(w)
+				}
+			}
+			atomic.AddInt64(&s.unfinished, -1)
 		}
 	}()
+	if s.http != nil {
+		go s.http.run(s.deliver)
+	}
 }
 
-func (s *Sink) queueMessage(msg io.WriterTo) {
-	select {
-	case s.messages <- msg:
-	default:
+// queueMessage queues msg unless it exceeds the sink's rate limits for the
+// namespace it originated from.
+func (s *Sink) queueMessage(msg io.WriterTo, src source) {
+	var size int
+	if m, ok := rfc5424Message(msg); ok {
+		size = len(m.Message)
+	}
+	if !s.limiter.allow(src.namespace, size) {
+		atomic.AddInt64(&s.messagesSuppressed, 1)
+		return
+	}
+	s.enqueue(msg, src)
+}
+
+// enqueue pushes msg onto the sink's queue, or the queue of the pool member
+// responsible for src.
+func (s *Sink) enqueue(msg io.WriterTo, src source) {
+	if s.pool != nil {
+		if !s.pool.enqueue(msg, src) {
+			atomic.AddInt64(&s.messagesDropped, 1)
+		}
+		return
+	}
+	// Count msg before the sink can pick it up. A message that is not
+	// queued leaves the number of queued messages unchanged as it is
+	// either dropped itself or takes the place of a dropped one.
+	atomic.AddInt64(&s.unfinished, 1)
+	if !s.messages.push(src.namespace, msg) {
+		atomic.AddInt64(&s.unfinished, -1)
 		md := atomic.AddInt64(&s.messagesDropped, 1)
 		if md%1000 == 0 && md != 0 {
-			log.Printf("Sink to address %s, at namespace [%s] dropped %d messages\n", s.Addr, s.Namespace, md)
+			log.Printf("Sink to address %s, at namespace [%s] dropped %d messages\n", RedactAddr(s.Addr), s.Namespace, md)
 		}
 	}
 }
 
 // write writes a rfc5424 syslog message to the connection of the specified
-// sink. It recreates the connection if one isn't established yet.
-func (s *Sink) write(w io.WriterTo) {
+// sink. It recreates the connection if one isn't established yet. A message
+// that fails to be written because the connection broke is written once
+// more to a new connection. Errors are recorded as the sink's latest error
+// and returned.
+func (s *Sink) write(w io.WriterTo) error {
 	defer atomic.StoreInt64(&s.lastSendAttemptNanos, time.Now().UnixNano())
 
-	err := s.maintainConnection()
-	if err != nil {
-		atomic.AddInt64(&s.messagesDropped, 1)
-		s.writeErr.Store(SinkError{
-			Msg:       err.Error(),
-			Timestamp: time.Now(),
-		})
-		return
+	var err error
+	if s.http != nil {
+		err = s.http.post(w)
+	} else {
+		err = s.maintainConnection()
+		if err == nil {
+			err = s.writeConn(w)
+			if err != nil && !isTimeout(err) {
+				atomic.AddInt64(&s.messagesResent, messageCount(w))
+				err = s.maintainConnection()
+				if err == nil {
+					err = s.writeConn(w)
+				}
+			}
+		}
 	}
-	_ = s.conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
-	_, err = w.WriteTo(s.conn)
 	if err != nil {
-		s.conn.Close()
-		s.conn = nil
-		atomic.AddInt64(&s.messagesDropped, 1)
 		s.writeErr.Store(SinkError{
 			Msg:       err.Error(),
 			Timestamp: time.Now(),
 		})
-		return
+		return err
+	}
+	s.wrote()
+	if s.relp == nil {
+		// RELP messages are counted once the receiver acknowledges them.
+		atomic.AddInt64(&s.messagesSent, messageCount(w))
 	}
 	s.writeErr.Store(SinkError{})
 	atomic.StoreInt64(&s.lastSendSuccessNanos, time.Now().UnixNano())
+	return nil
+}
+
+// deliver writes w to the sink, retrying according to the sink's retry
+// policy and skipping the write while its circuit breaker is open. Without a
+// retry policy a failed message is dropped right away, as are messages that
+// failed with a permanent error.
+func (s *Sink) deliver(w io.WriterTo) {
+	first := time.Now()
+	for attempt := 1; ; attempt++ {
+		if !s.breaker.allow() {
+			atomic.AddInt64(&s.messagesDropped, messageCount(w))
+			return
+		}
+		s.backoff.wait()
+
+		err := s.write(w)
+		if err == nil {
+			s.backoff.succeed()
+			s.breaker.succeed()
+			return
+		}
+		if _, ok := err.(permanentError); ok {
+			atomic.AddInt64(&s.messagesDropped, messageCount(w))
+			return
+		}
+		now := time.Now()
+		s.breaker.fail(now)
+
+		if s.backoff == nil {
+			atomic.AddInt64(&s.messagesDropped, messageCount(w))
+			return
+		}
+		s.backoff.fail(now)
+		if !s.shouldRetry(attempt, now.Sub(first)) {
+			atomic.AddInt64(&s.messagesDropped, messageCount(w))
+			return
+		}
+		atomic.AddInt64(&s.messagesRetried, 1)
+	}
+}
+
+// writeConn writes w to the sink's connection, closing it if that fails.
+func (s *Sink) writeConn(w io.WriterTo) error {
+	_ = s.conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+	var err error
+	if s.relp != nil {
+		err = s.relp.send(w, s.writeTimeout)
+	} else if dc, ok := s.conn.(*datagramConn); ok {
+		err = dc.writeMessage(w)
+	} else {
+		_, err = w.WriteTo(s.conn)
+	}
+	if err != nil {
+		s.closeConn()
+		s.failover.writeFailed()
+	}
+	return err
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// MessagesSent returns the number of messages written to the sink's
+// connection or posted to its HTTPS drain.
+func (s *Sink) MessagesSent() int64 {
+	if s.pool != nil {
+		return s.pool.count(func(m *Sink) *int64 { return &m.messagesSent })
+	}
+	return atomic.LoadInt64(&s.messagesSent)
+}
+
+// MessagesResent returns the number of messages that were written again
+// after the connection broke while writing them.
+func (s *Sink) MessagesResent() int64 {
+	if s.pool != nil {
+		return s.pool.count(func(m *Sink) *int64 { return &m.messagesResent })
+	}
+	return atomic.LoadInt64(&s.messagesResent)
 }
 
 func (s *Sink) MessagesDropped() int64 {
+	if s.pool != nil {
+		return atomic.LoadInt64(&s.messagesDropped) +
+			s.pool.count(func(m *Sink) *int64 { return &m.messagesDropped })
+	}
 	return atomic.LoadInt64(&s.messagesDropped)
 }
 
-func tlsMaintainConn(s *Sink, out *Out) func() error {
-	return func() error {
-		if s.conn == nil {
-			var (
-				conn  net.Conn // conn needs to be of type net.Conn, not *tls.Conn
-				roots *x509.CertPool
-				pem   []byte
-				err   error
-			)
+func tlsDial(s *Sink, out *Out) func(addr string) (net.Conn, error) {
+	return func(addr string) (net.Conn, error) {
+		cfg, err := tlsConfig(s.TLS, s.serverName)
+		if err != nil {
+			return nil, err
+		}
 
-			if !s.TLS.InsecureSkipVerify && s.TLS.RootCA != "" {
-				roots = x509.NewCertPool()
+		network, address := splitNetwork(addr)
+		conn, err := tls.DialWithDialer(out.dialer(s), network, address, cfg)
+		if err != nil {
+			// Return a nil interface rather than a nil *tls.Conn.
+			return nil, err
+		}
+		return conn, nil
+	}
+}
 
-				pem, err = ioutil.ReadFile(s.TLS.RootCA)
-				if err != nil {
-					return err
-				}
+// ClientConfig returns the configuration sinks use to establish TLS
+// connections to serverName, reading the root CA if one is set.
+func (t *TLS) ClientConfig(serverName string) (*tls.Config, error) {
+	return tlsConfig(t, serverName)
+}
 
-				if ok := roots.AppendCertsFromPEM(pem); !ok {
-					return fmt.Errorf("append certificate failed")
-				}
-			}
+// tlsConfig returns the client TLS configuration for t, reading the root CA
+// if one is configured.
+func tlsConfig(t *TLS, serverName string) (*tls.Config, error) {
+	var roots *x509.CertPool
+	if !t.InsecureSkipVerify && t.RootCA != "" {
+		roots = x509.NewCertPool()
 
-			conn, err = tls.DialWithDialer(
-				&net.Dialer{
-					Timeout: out.dialTimeout,
-				},
-				"tcp",
-				s.Addr,
-				&tls.Config{
-					InsecureSkipVerify: s.TLS.InsecureSkipVerify,
-					RootCAs:            roots,
-				},
-			)
-
-			if err == nil {
-				s.conn = conn
-			}
-			return err
+		pem, err := ioutil.ReadFile(t.RootCA)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok := roots.AppendCertsFromPEM(pem); !ok {
+			return nil, fmt.Errorf("append certificate failed")
 		}
-		return nil
 	}
+
+	return &tls.Config{
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		RootCAs:            roots,
+		ServerName:         serverName,
+	}, nil
 }
 
-func tcpMaintainConn(s *Sink, out *Out) func() error {
-	return func() error {
-		if s.conn == nil {
-			dialer := net.Dialer{
-				Timeout: out.dialTimeout,
-			}
-			conn, err := dialer.Dial("tcp", s.Addr)
-			if err == nil {
-				s.conn = conn
-			}
-			return err
+func tcpDial(s *Sink, out *Out) func(addr string) (net.Conn, error) {
+	return func(addr string) (net.Conn, error) {
+		network, address := splitNetwork(addr)
+		conn, err := out.dialer(s).Dial(network, address)
+		if err != nil {
+			return nil, err
 		}
-		return nil
+		if network == "unixgram" {
+			return &datagramConn{Conn: conn}, nil
+		}
+		return conn, nil
 	}
 }
 
+// convert builds the syslog message for a record. The metadata derived from
+// the record's kubernetes metadata is cached per container so that records
+// of known containers only allocate their body and the message itself.
 func convert(
 	record map[interface{}]interface{},
 	ts time.Time,
 	tag string,
-	sanitizeHost bool,
-) (*rfc5424.Message, string) {
+	cache *metadataCache,
+) (*rfc5424.Message, source) {
 	var (
-		logmsg []byte
-		k8sMap map[interface{}]interface{}
-		host   string
+		logmsg      []byte
+		k8sMap      map[interface{}]interface{}
+		clusterName []byte
 	)
 
 	for k, v := range record {
@@ -353,17 +856,16 @@ func convert(
 			if !ok2 {
 				continue
 			}
-			host = string(v2)
+			clusterName = v2
 		}
 	}
 
 	var (
-		vmID          string
-		appName       string
-		podName       string
-		namespaceName string
-		containerName string
-		labelParams   []rfc5424.SDParam
+		vmID          []byte
+		podName       []byte
+		namespaceName []byte
+		containerName []byte
+		labels        map[interface{}]interface{}
 	)
 	for k, v := range k8sMap {
 		key, ok := k.(string)
@@ -371,88 +873,62 @@ func convert(
 			continue
 		}
 
+		switch key {
+		case "labels":
+			labels, _ = v.(map[interface{}]interface{})
+			continue
+		case "host", "container_name", "pod_name", "namespace_name":
+		default:
+			continue
+		}
+		v2, ok := v.([]byte)
+		if !ok {
+			continue
+		}
 		switch key {
 		case "host":
-			v2, ok2 := v.([]byte)
-			if !ok2 {
-				continue
-			}
-			vmID = string(v2)
+			vmID = v2
 		case "container_name":
-			v2, ok2 := v.([]byte)
-			if !ok2 {
-				continue
-			}
-			containerName = string(v2)
+			containerName = v2
 		case "pod_name":
-			v2, ok2 := v.([]byte)
-			if !ok2 {
-				continue
-			}
-			podName = string(v2)
+			podName = v2
 		case "namespace_name":
-			v2, ok2 := v.([]byte)
-			if !ok2 {
-				continue
-			}
-			namespaceName = string(v2)
-		case "labels":
-			v2, ok2 := v.(map[interface{}]interface{})
-			if !ok2 {
-				continue
-			}
-			labelParams = processLabels(v2)
+			namespaceName = v2
 		}
 	}
 
-	k8sStructuredData := buildStructuredData(
-		labelParams,
-		namespaceName,
-		podName,
-		containerName,
-		vmID,
-	)
-
+	prefix := logPrefix
+	if strings.HasPrefix(tag, eventPrefix) {
+		prefix = eventPrefix
+	}
+	var meta *podMetadata
 	if len(k8sMap) != 0 {
-		prefix := logPrefix
-		if strings.HasPrefix(tag, eventPrefix) {
-			prefix = eventPrefix
-		}
-		appName = fmt.Sprintf(
-			"%s/%s/%s/%s",
-			prefix,
-			namespaceName,
-			podName,
-			containerName,
-		)
-		// APP-NAME is limited to 48 chars in RFC 5424
-		// https://tools.ietf.org/html/rfc5424#section-6
-		if len(appName) > 48 {
-			appName = appName[:48]
-		}
+		meta = cache.metadata(namespaceName, podName, containerName, vmID, prefix, labels)
+	} else {
+		meta = newPodMetadata("", "", "", "", prefix, nil, false)
 	}
 
 	if !bytes.HasSuffix(logmsg, []byte("\n")) {
 		logmsg = append(logmsg, byte('\n'))
 	}
 
-	if host == "" {
+	host := clusterName
+	if len(host) == 0 {
 		host = vmID
 	}
-	if sanitizeHost {
-		host = sanitizeHostname(host)
-	}
 
 	return &rfc5424.Message{
-		Priority:  rfc5424.Info + rfc5424.User,
-		Timestamp: ts,
-		Hostname:  host,
-		AppName:   appName,
-		Message:   logmsg,
-		StructuredData: []rfc5424.StructuredData{
-			k8sStructuredData,
-		},
-	}, namespaceName
+		Priority:       rfc5424.Info + rfc5424.User,
+		Timestamp:      ts,
+		Hostname:       cache.hostname(host),
+		AppName:        meta.appName,
+		Message:        logmsg,
+		StructuredData: meta.structuredData,
+	}, source{
+		namespace: meta.namespace,
+		pod:       meta.pod,
+		container: meta.container,
+	}
 }
 
 func processLabels(labels map[interface{}]interface{}) []rfc5424.SDParam {
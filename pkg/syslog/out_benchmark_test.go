@@ -0,0 +1,99 @@
+package syslog_test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+func benchmarkRecord() map[interface{}]interface{} {
+	return map[interface{}]interface{}{
+		"log":          []byte("some log message of a typical length for a container writing to stdout\n"),
+		"stream":       []byte("stdout"),
+		"cluster_name": []byte("some-cluster"),
+		"kubernetes": map[interface{}]interface{}{
+			"pod_name":       []byte("some-app-5d8f7c9b6-x2x7q"),
+			"namespace_name": []byte("ns1"),
+			"pod_id":         []byte("0d6f1a2e-5b1c-4b8a-9e0f-6c2d7e8f9a0b"),
+			"host":           []byte("node-1.example.com"),
+			"container_name": []byte("some-app"),
+			"docker_id":      []byte("3c5e9f1a2b4d6e8f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f"),
+			"labels": map[interface{}]interface{}{
+				"app":               []byte("some-app"),
+				"pod-template-hash": []byte("5d8f7c9b6"),
+				"tier":              []byte("backend"),
+			},
+		},
+	}
+}
+
+// discardListener accepts connections and discards everything written to
+// them.
+func discardListener(b *testing.B) net.Listener {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(ioutil.Discard, conn)
+			}()
+		}
+	}()
+	return lis
+}
+
+func BenchmarkOutWrite(b *testing.B) {
+	ts := time.Unix(0, 0).UTC()
+
+	b.Run("no sinks", func(b *testing.B) {
+		out := syslog.NewOut(nil, nil, syslog.WithSanitizeHost(true))
+		record := benchmarkRecord()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			out.Write(record, ts, "pod.log")
+		}
+	})
+
+	b.Run("conversion workers", func(b *testing.B) {
+		out := syslog.NewOut(nil, nil, syslog.WithSanitizeHost(true), syslog.WithConversionWorkers(4))
+		pods := make([]map[interface{}]interface{}, 16)
+		for i := range pods {
+			pods[i] = benchmarkRecord()
+			k8s := pods[i]["kubernetes"].(map[interface{}]interface{})
+			k8s["pod_name"] = []byte(fmt.Sprintf("pod-%d", i))
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			out.Write(pods[i%len(pods)], ts, "pod.log")
+		}
+		out.Wait()
+	})
+
+	b.Run("namespace and cluster sink", func(b *testing.B) {
+		lis := discardListener(b)
+		defer lis.Close()
+		// The queues hold all messages so that none are dropped.
+		sinks := []*syslog.Sink{{Addr: lis.Addr().String(), Namespace: "ns1", QueueSize: b.N}}
+		clusterSinks := []*syslog.Sink{{Addr: lis.Addr().String(), QueueSize: b.N}}
+		out := syslog.NewOut(sinks, clusterSinks, syslog.WithSanitizeHost(true))
+		record := benchmarkRecord()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			out.Write(record, ts, "pod.log")
+		}
+	})
+}
@@ -125,6 +125,55 @@ var _ = Describe("Out", func() {
 			)
 		})
 
+		It("updates the structured data of a pod whose labels change", func() {
+			spySink := newSpySink()
+			defer spySink.stop()
+			s := syslog.Sink{
+				Addr:      spySink.url(),
+				Namespace: "kube-system",
+			}
+			out := syslog.NewOut([]*syslog.Sink{&s}, nil)
+			record := func(container, version string) map[interface{}]interface{} {
+				return map[interface{}]interface{}{
+					"log": []byte("some-log"),
+					"kubernetes": map[interface{}]interface{}{
+						"labels": map[interface{}]interface{}{
+							"version": []byte(version),
+						},
+						"pod_id":         []byte("some-pod-id"),
+						"pod_name":       []byte("etcd-minikube"),
+						"namespace_name": []byte("kube-system"),
+						"container_name": []byte(container),
+					},
+				}
+			}
+			sd := func(container, version string) []rfc5424.StructuredData {
+				return []rfc5424.StructuredData{
+					{
+						ID: "kubernetes@47450",
+						Parameters: []rfc5424.SDParam{
+							{Name: "version", Value: version},
+							{Name: "namespace_name", Value: "kube-system"},
+							{Name: "object_name", Value: "etcd-minikube"},
+							{Name: "container_name", Value: container},
+						},
+					},
+				}
+			}
+
+			out.Write(record("etcd", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+			out.Write(record("sidecar", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+			out.Write(record("etcd", "v1"), time.Unix(0, 0).UTC(), "pod.log")
+			out.Write(record("etcd", "v2"), time.Unix(0, 0).UTC(), "pod.log")
+
+			spySink.expectReceivedWithSD(
+				sd("etcd", "v1"),
+				sd("sidecar", "v1"),
+				sd("etcd", "v1"),
+				sd("etcd", "v2"),
+			)
+		})
+
 		It("skips labels that are not string/[]byte type", func() {
 			spySink := newSpySink()
 			defer spySink.stop()
@@ -211,6 +260,29 @@ var _ = Describe("Out", func() {
 				}).Should(BeNumerically(">", 0))
 			})
 
+			It("counts the messages sent", func() {
+				spySink := newSpySink()
+				defer spySink.stop()
+				s := syslog.Sink{
+					Addr:      spySink.url(),
+					Namespace: "ns1",
+				}
+				out := syslog.NewOut([]*syslog.Sink{&s}, nil)
+				record := map[interface{}]interface{}{
+					"log": []byte("some-log"),
+					"kubernetes": map[interface{}]interface{}{
+						"namespace_name": []byte("ns1"),
+					},
+				}
+
+				out.Write(record, time.Unix(0, 0).UTC(), "pod.log")
+				out.Write(record, time.Unix(0, 0).UTC(), "pod.log")
+
+				conn := spySink.accept()
+				defer conn.Close()
+				Eventually(s.MessagesSent).Should(Equal(int64(2)))
+			})
+
 			It("keeps track of cluster sinks states", func() {
 				spySink := newSpySink()
 				defer spySink.stop()
@@ -1172,9 +1244,10 @@ var _ = Describe("Out", func() {
 			}
 			out.Write(record, time.Unix(0, 0).UTC(), "pod.log")
 
-			spySink.expectReceived(
+			conn := spySink.expectReceivedOpen(
 				`<14>1 1970-01-01T00:00:00+00:00 - pod.log/some-namespace// - - [kubernetes@47450 namespace_name="some-namespace" object_name="" container_name=""] some-log-message` + "\n",
 			)
+			defer conn.Close()
 
 			out.Write(record, time.Unix(0, 0).UTC(), "pod.log")
 
@@ -1322,9 +1395,10 @@ var _ = Describe("Out", func() {
 				out.Write(record, time.Unix(0, 0).UTC(), "pod.log")
 			}()
 
-			spySink.expectReceived(
+			conn := spySink.expectReceivedOpen(
 				`<14>1 1970-01-01T00:00:00+00:00 - pod.log/some-namespace// - - [kubernetes@47450 namespace_name="some-namespace" object_name="" container_name=""] some-log-message` + "\n",
 			)
+			defer conn.Close()
 
 			goOn := make(chan struct{})
 			go func() {
@@ -1372,32 +1446,29 @@ var _ = Describe("Out", func() {
 			spySink = newTLSSpySink(spySink.url())
 			defer spySink.stop()
 
-			f := func() int64 {
-				r2 := map[interface{}]interface{}{
-					"log": []byte("some-log-message-2"),
-					"kubernetes": map[interface{}]interface{}{
-						"namespace_name": []byte("some-namespace"),
-					},
-				}
-				out.Write(r2, time.Unix(0, 0).UTC(), "pod.log")
-				return s.MessagesDropped()
-			}
-			Eventually(f).Should(BeNumerically(">=", 1))
-
+			// The closed connection is noticed in the background, so no
+			// message written afterwards is lost.
+			Eventually(func() bool {
+				return out.SinkState()[0].Connected
+			}).Should(BeFalse())
 			go func() {
 				defer GinkgoRecover()
-				r3 := map[interface{}]interface{}{
-					"log": []byte("some-log-message-3"),
-					"kubernetes": map[interface{}]interface{}{
-						"namespace_name": []byte("some-namespace"),
-					},
+				for _, msg := range []string{"some-log-message-2", "some-log-message-3"} {
+					r := map[interface{}]interface{}{
+						"log": []byte(msg),
+						"kubernetes": map[interface{}]interface{}{
+							"namespace_name": []byte("some-namespace"),
+						},
+					}
+					out.Write(r, time.Unix(0, 0).UTC(), "pod.log")
 				}
-				out.Write(r3, time.Unix(0, 0).UTC(), "pod.log")
 			}()
 
 			spySink.expectReceivedIncludes(
-				`<14>1 1970-01-01T00:00:00+00:00 - pod.log/some-namespace// - - [kubernetes@47450 namespace_name="some-namespace" object_name="" container_name=""] some-log-message-3` + "\n",
+				`<14>1 1970-01-01T00:00:00+00:00 - pod.log/some-namespace// - - [kubernetes@47450 namespace_name="some-namespace" object_name="" container_name=""] some-log-message-2`+"\n",
+				`<14>1 1970-01-01T00:00:00+00:00 - pod.log/some-namespace// - - [kubernetes@47450 namespace_name="some-namespace" object_name="" container_name=""] some-log-message-3`+"\n",
 			)
+			Expect(s.MessagesDropped()).To(BeZero())
 		})
 
 		It("writes messages via syslog-tls w/o rootCA verify", func() {
@@ -0,0 +1,101 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// ProbeResult is the outcome of connecting to one of the addresses of a
+// sink.
+type ProbeResult struct {
+	Addr string
+	// TLS is the state of the connection if it uses TLS.
+	TLS *tls.ConnectionState
+	Err error
+}
+
+// Probe connects to every address of s the way the sink would once passed
+// to NewOut, without writing any messages. SRV records and the hosts of
+// balancing sinks are resolved, RELP sessions are opened and HTTPS drains
+// are connected to without sending a request. The dial timeout and the
+// resolver are configured by opts as with NewOut. An error resolving the
+// addresses is returned along with the results for the addresses that
+// could be resolved.
+func Probe(s *Sink, opts ...OutOption) ([]ProbeResult, error) {
+	o := &Out{
+		dialTimeout: 5 * time.Second,
+		resolver:    net.DefaultResolver,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var (
+		eps []endpoint
+		err error
+	)
+	if s.balances() {
+		eps, err = o.balanceEndpoints(s)
+	} else {
+		var addrs []string
+		addrs, err = o.sinkAddrs(s)
+		for _, a := range addrs {
+			eps = append(eps, endpoint{addr: a})
+		}
+	}
+
+	results := make([]ProbeResult, 0, len(eps))
+	for _, ep := range eps {
+		results = append(results, o.probe(s, ep))
+	}
+	return results, err
+}
+
+func (o *Out) probe(s *Sink, ep endpoint) ProbeResult {
+	r := ProbeResult{Addr: RedactAddr(ep.addr)}
+	m := &Sink{
+		TLS:        s.TLS,
+		KeepAlive:  s.KeepAlive,
+		serverName: ep.host,
+	}
+	addr := ep.addr
+	relp := s.Protocol == ProtocolRELP
+	if isHTTPAddr(addr) {
+		u, err := url.Parse(addr)
+		if err != nil {
+			r.Err = fmt.Errorf("invalid drain URL %s", r.Addr)
+			return r
+		}
+		addr = u.Host
+		if m.TLS == nil {
+			m.TLS = &TLS{}
+		}
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		}
+		relp = false
+	}
+
+	dial := tcpDial(m, o)
+	if m.TLS != nil {
+		dial = tlsDial(m, o)
+	}
+	conn, err := dial(addr)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer conn.Close()
+
+	if c, ok := conn.(*tls.Conn); ok {
+		state := c.ConnectionState()
+		r.TLS = &state
+	}
+	if relp {
+		_, r.Err = relpOpen(conn, o.dialTimeout)
+	}
+	return r
+}
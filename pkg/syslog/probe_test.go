@@ -0,0 +1,149 @@
+package syslog_test
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Probe", func() {
+	It("connects to the address and the failover addresses of a sink", func() {
+		spySink := newSpySink("127.0.0.1:0")
+		defer spySink.stop()
+		stopped := newSpySink("127.0.0.1:0")
+		stopped.stop()
+		s := &syslog.Sink{
+			Addr:          spySink.url(),
+			FailoverAddrs: []string{stopped.url()},
+		}
+
+		results, err := syslog.Probe(s, syslog.WithDialTimeout(time.Second))
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(HaveLen(2))
+		Expect(results[0].Addr).To(Equal(spySink.url()))
+		Expect(results[0].Err).ToNot(HaveOccurred())
+		Expect(results[0].TLS).To(BeNil())
+		Expect(results[1].Addr).To(Equal(stopped.url()))
+		Expect(results[1].Err).To(HaveOccurred())
+	})
+
+	It("completes the TLS handshake", func() {
+		spySink := newTLSSpySink("127.0.0.1:0")
+		defer spySink.stop()
+		go func() {
+			conn, err := spySink.lis.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_ = conn.(*tls.Conn).Handshake()
+		}()
+		s := &syslog.Sink{
+			Addr: spySink.url(),
+			TLS: &syslog.TLS{
+				InsecureSkipVerify: true,
+			},
+		}
+
+		results, err := syslog.Probe(s)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Err).ToNot(HaveOccurred())
+		Expect(results[0].TLS).ToNot(BeNil())
+		Expect(results[0].TLS.HandshakeComplete).To(BeTrue())
+	})
+
+	It("reports an unreadable root CA", func() {
+		spySink := newTLSSpySink("127.0.0.1:0")
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr: spySink.url(),
+			TLS: &syslog.TLS{
+				RootCA: "./testdata/missing.crt",
+			},
+		}
+
+		results, err := syslog.Probe(s)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Err).To(HaveOccurred())
+	})
+
+	It("opens a RELP session", func() {
+		server := newRELPServer(false)
+		defer server.stop()
+		s := &syslog.Sink{
+			Addr:     server.url(),
+			Protocol: syslog.ProtocolRELP,
+		}
+
+		results, err := syslog.Probe(s)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Err).ToNot(HaveOccurred())
+		Expect(server.offers()).To(ContainElement("commands=syslog"))
+	})
+
+	It("reports receivers that do not speak RELP", func() {
+		spySink := newSpySink("127.0.0.1:0")
+		defer spySink.stop()
+		go func() {
+			conn, err := spySink.lis.Accept()
+			if err == nil {
+				_ = conn.Close()
+			}
+		}()
+		s := &syslog.Sink{
+			Addr:     spySink.url(),
+			Protocol: syslog.ProtocolRELP,
+		}
+
+		results, err := syslog.Probe(s)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Err).To(HaveOccurred())
+	})
+
+	It("returns the error resolving SRV records", func() {
+		spySink := newSpySink("127.0.0.1:0")
+		defer spySink.stop()
+		s := &syslog.Sink{
+			SRV:           "missing.example.com",
+			FailoverAddrs: []string{spySink.url()},
+		}
+
+		results, err := syslog.Probe(s, syslog.WithResolver(newSpyResolver()))
+
+		Expect(err).To(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Addr).To(Equal(spySink.url()))
+		Expect(results[0].Err).ToNot(HaveOccurred())
+	})
+
+	It("resolves the hosts of balancing sinks", func() {
+		spySink := newSpySink("127.0.0.1:0")
+		defer spySink.stop()
+		_, port, err := net.SplitHostPort(spySink.url())
+		Expect(err).ToNot(HaveOccurred())
+		s := &syslog.Sink{
+			BalanceHost: net.JoinHostPort("127.0.0.1", port),
+		}
+
+		results, err := syslog.Probe(s, syslog.WithResolver(newSpyResolver()))
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Addr).To(Equal(spySink.url()))
+		Expect(results[0].Err).ToNot(HaveOccurred())
+	})
+})
@@ -0,0 +1,446 @@
+package syslog
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy determines what happens when a message is queued on a sink
+// whose queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDropNewest drops the message being queued.
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	// OverflowDropOldest drops the oldest queued message to make room,
+	// which suits live tailing where recent messages matter most.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowBlock waits up to the sink's OverflowTimeout for room in the
+	// queue before dropping the message being queued.
+	OverflowBlock OverflowPolicy = "block"
+)
+
+const defaultOverflowTimeout = 100 * time.Millisecond
+
+// ParseOverflowPolicy returns the OverflowPolicy for the given configuration
+// value. An empty value results in OverflowDropNewest.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(s); p {
+	case "":
+		return OverflowDropNewest, nil
+	case OverflowDropNewest, OverflowDropOldest, OverflowBlock:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown overflow policy %q", s)
+}
+
+// overflow is the overflow behaviour of a queue.
+type overflow struct {
+	policy  OverflowPolicy
+	timeout time.Duration
+}
+
+// queue buffers the messages of a sink until they are written.
+type queue interface {
+	// push adds msg originating from namespace to the queue. It returns
+	// false if msg, or an older message to make room for it, was dropped
+	// because the queue is full.
+	push(namespace string, msg io.WriterTo) bool
+	// pop blocks until a message is available and returns it. It returns
+	// nil once the queue is closed and empty.
+	pop() io.WriterTo
+	// popTimeout is like pop but gives up after d. ok is false if no
+	// message arrived in time.
+	popTimeout(d time.Duration) (msg io.WriterTo, ok bool)
+	// close stops the queue from accepting messages. The messages already
+	// queued can still be popped.
+	close()
+}
+
+// chanQueue is a FIFO queue shared by all namespaces.
+type chanQueue struct {
+	ch       chan io.WriterTo
+	overflow overflow
+
+	// dropMu serializes pushes with OverflowDropOldest so that only the
+	// consumer can change the queue between dropping the oldest message
+	// and queuing the new one.
+	dropMu sync.Mutex
+}
+
+func newChanQueue(size int, o overflow) *chanQueue {
+	return &chanQueue{
+		ch:       make(chan io.WriterTo, size),
+		overflow: o,
+	}
+}
+
+func (q *chanQueue) push(_ string, msg io.WriterTo) bool {
+	if q.overflow.policy == OverflowDropOldest {
+		return q.pushDropOldest(msg)
+	}
+
+	select {
+	case q.ch <- msg:
+		return true
+	default:
+	}
+
+	if q.overflow.policy == OverflowBlock {
+		t := time.NewTimer(q.overflow.timeout)
+		defer t.Stop()
+		select {
+		case q.ch <- msg:
+			return true
+		case <-t.C:
+		}
+	}
+	return false
+}
+
+// pushDropOldest queues msg, dropping the oldest message while the queue
+// is full. As other pushes wait for dropMu, the consumer can only make
+// room, so at most one message is dropped.
+func (q *chanQueue) pushDropOldest(msg io.WriterTo) bool {
+	q.dropMu.Lock()
+	defer q.dropMu.Unlock()
+
+	if cap(q.ch) == 0 {
+		// There is never an older message to make room.
+		select {
+		case q.ch <- msg:
+			return true
+		default:
+			return false
+		}
+	}
+	dropped := false
+	for {
+		select {
+		case q.ch <- msg:
+			return !dropped
+		default:
+		}
+		select {
+		case <-q.ch:
+			dropped = true
+		default:
+		}
+	}
+}
+
+func (q *chanQueue) pop() io.WriterTo {
+	return <-q.ch
+}
+
+func (q *chanQueue) popTimeout(d time.Duration) (io.WriterTo, bool) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case msg := <-q.ch:
+		return msg, true
+	case <-t.C:
+		return nil, false
+	}
+}
+
+// close closes the channel. As pushing to a closed channel panics the caller
+// must ensure that push is not called afterwards.
+func (q *chanQueue) close() {
+	close(q.ch)
+}
+
+// fairQueue keeps a separate FIFO queue per namespace and drains them round
+// robin so that a log storm in one namespace only causes drops for that
+// namespace. A namespace with weight n is drained n messages at a time. All
+// namespaces share a capacity of size messages; once it is used up a message
+// of a namespace with fewer queued messages than another takes the place of
+// the oldest message of the namespace with the most, while the overflow
+// policy applies to messages of that namespace.
+type fairQueue struct {
+	size     int
+	weights  map[string]int
+	overflow overflow
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queues map[string]*subQueue
+	// active lists the namespaces with queued messages in the order they
+	// are drained. Only they have a subQueue.
+	active  []string
+	total   int
+	next    int
+	credit  int
+	dropped map[string]int64
+	closed  bool
+
+	// freed is closed and replaced whenever a message is popped while
+	// pushes are waiting for room.
+	freed   chan struct{}
+	waiting int
+}
+
+type subQueue struct {
+	msgs []io.WriterTo
+}
+
+// maxDropNamespaces limits the number of namespaces a fairQueue counts drops
+// for. Drops of further namespaces are counted under otherNamespaces.
+const maxDropNamespaces = 1000
+
+// otherNamespaces is the key of the drops of namespaces beyond
+// maxDropNamespaces. It is not a valid namespace name.
+const otherNamespaces = "(other)"
+
+// newFairQueue returns a fairQueue that holds up to size messages across
+// all namespaces.
+func newFairQueue(size int, weights map[string]int, o overflow) *fairQueue {
+	q := &fairQueue{
+		size:     size,
+		weights:  weights,
+		overflow: o,
+		queues:   make(map[string]*subQueue),
+		dropped:  make(map[string]int64),
+		freed:    make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *fairQueue) push(namespace string, msg io.WriterTo) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		q.drop(namespace)
+		return false
+	}
+
+	if q.total >= q.size {
+		var queued int
+		if sq, ok := q.queues[namespace]; ok {
+			queued = len(sq.msgs)
+		}
+		if i := q.longest(); i >= 0 && len(q.queues[q.active[i]].msgs) > queued {
+			// Another namespace uses more of the capacity and makes
+			// room.
+			q.dropOldest(i)
+			q.append(namespace, msg)
+			return false
+		}
+
+		switch q.overflow.policy {
+		case OverflowDropOldest:
+			q.drop(namespace)
+			if queued == 0 {
+				return false
+			}
+			// The namespace stays active since its queue is never empty.
+			sq := q.queues[namespace]
+			sq.msgs[0] = nil
+			sq.msgs = append(sq.msgs[1:], msg)
+			return false
+		case OverflowBlock:
+			if !q.waitForRoom() {
+				q.drop(namespace)
+				return false
+			}
+		default:
+			q.drop(namespace)
+			return false
+		}
+	}
+
+	q.append(namespace, msg)
+	return true
+}
+
+// append adds msg to the queue of namespace and marks namespace as active.
+// It must be called with q.mu held.
+func (q *fairQueue) append(namespace string, msg io.WriterTo) {
+	sq, ok := q.queues[namespace]
+	if !ok {
+		sq = &subQueue{}
+		q.queues[namespace] = sq
+		q.active = append(q.active, namespace)
+	}
+	sq.msgs = append(sq.msgs, msg)
+	q.total++
+	q.cond.Signal()
+}
+
+// longest returns the index of the active namespace with the most queued
+// messages, or -1 if no namespace is active. It must be called with q.mu
+// held.
+func (q *fairQueue) longest() int {
+	longest := -1
+	for i, ns := range q.active {
+		if longest < 0 || len(q.queues[ns].msgs) > len(q.queues[q.active[longest]].msgs) {
+			longest = i
+		}
+	}
+	return longest
+}
+
+// dropOldest drops the oldest message of the active namespace at index i.
+// It must be called with q.mu held.
+func (q *fairQueue) dropOldest(i int) {
+	namespace := q.active[i]
+	sq := q.queues[namespace]
+	sq.msgs[0] = nil
+	sq.msgs = sq.msgs[1:]
+	q.total--
+	q.drop(namespace)
+	if len(sq.msgs) == 0 {
+		q.deactivate(i)
+	}
+}
+
+// deactivate removes the namespace at index i of the active namespaces
+// along with its empty queue. It must be called with q.mu held.
+func (q *fairQueue) deactivate(i int) {
+	delete(q.queues, q.active[i])
+	q.active = append(q.active[:i], q.active[i+1:]...)
+	switch {
+	case i < q.next:
+		q.next--
+	case i == q.next:
+		q.credit = 0
+	}
+}
+
+// drop counts a message of namespace as dropped. It must be called with
+// q.mu held.
+func (q *fairQueue) drop(namespace string) {
+	if _, ok := q.dropped[namespace]; !ok && len(q.dropped) >= maxDropNamespaces {
+		namespace = otherNamespaces
+	}
+	q.dropped[namespace]++
+}
+
+// waitForRoom waits up to the overflow timeout for the queue to have room
+// for another message. It must be called with q.mu held.
+func (q *fairQueue) waitForRoom() bool {
+	t := time.NewTimer(q.overflow.timeout)
+	defer t.Stop()
+
+	for q.total >= q.size {
+		freed := q.freed
+		q.waiting++
+		q.mu.Unlock()
+
+		var timedOut bool
+		select {
+		case <-freed:
+		case <-t.C:
+			timedOut = true
+		}
+
+		q.mu.Lock()
+		q.waiting--
+		if timedOut {
+			return q.total < q.size
+		}
+	}
+	return true
+}
+
+func (q *fairQueue) pop() io.WriterTo {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.active) == 0 {
+		if q.closed {
+			return nil
+		}
+		q.cond.Wait()
+	}
+	return q.popLocked()
+}
+
+func (q *fairQueue) popTimeout(d time.Duration) (io.WriterTo, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	deadline := time.Now().Add(d)
+	t := time.AfterFunc(d, func() {
+		q.mu.Lock()
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	})
+	defer t.Stop()
+
+	for len(q.active) == 0 {
+		if q.closed {
+			return nil, true
+		}
+		if !time.Now().Before(deadline) {
+			return nil, false
+		}
+		q.cond.Wait()
+	}
+	return q.popLocked(), true
+}
+
+// popLocked removes the next message from a non-empty queue. It must be
+// called with the lock held.
+func (q *fairQueue) popLocked() io.WriterTo {
+	if q.next >= len(q.active) {
+		q.next = 0
+	}
+	namespace := q.active[q.next]
+	sq := q.queues[namespace]
+
+	msg := sq.msgs[0]
+	sq.msgs[0] = nil
+	sq.msgs = sq.msgs[1:]
+	q.total--
+	q.credit++
+
+	switch {
+	case len(sq.msgs) == 0:
+		// Forget the namespace so that neither its queue nor a burst's
+		// backing array stay in memory.
+		q.deactivate(q.next)
+	case q.credit >= q.weight(namespace):
+		q.next++
+		q.credit = 0
+	}
+
+	if q.waiting > 0 {
+		close(q.freed)
+		q.freed = make(chan struct{})
+	}
+	return msg
+}
+
+func (q *fairQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+func (q *fairQueue) weight(namespace string) int {
+	if w := q.weights[namespace]; w > 0 {
+		return w
+	}
+	return 1
+}
+
+// drops returns the number of dropped messages per namespace.
+func (q *fairQueue) drops() map[string]int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.dropped) == 0 {
+		return nil
+	}
+	drops := make(map[string]int64, len(q.dropped))
+	for ns, n := range q.dropped {
+		drops[ns] = n
+	}
+	return drops
+}
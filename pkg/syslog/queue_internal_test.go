@@ -0,0 +1,106 @@
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("fairQueue", func() {
+	msg := func(s string) io.WriterTo {
+		return bytes.NewBufferString(s)
+	}
+
+	It("shares its size between namespaces", func() {
+		q := newFairQueue(4, nil, overflow{policy: OverflowDropNewest})
+
+		for i := 0; i < 100; i++ {
+			q.push(fmt.Sprintf("ns%d", i), msg("some-log"))
+		}
+		Expect(q.total).To(Equal(4))
+		Expect(q.queues).To(HaveLen(4))
+	})
+
+	It("makes room with the oldest message of the longest queue", func() {
+		q := newFairQueue(3, nil, overflow{policy: OverflowDropNewest})
+
+		Expect(q.push("noisy", msg("noisy-1"))).To(BeTrue())
+		Expect(q.push("noisy", msg("noisy-2"))).To(BeTrue())
+		Expect(q.push("noisy", msg("noisy-3"))).To(BeTrue())
+		Expect(q.push("noisy", msg("noisy-4"))).To(BeFalse())
+		Expect(q.push("quiet", msg("quiet-1"))).To(BeFalse())
+
+		var msgs []string
+		for i := 0; i < 3; i++ {
+			msgs = append(msgs, q.pop().(*bytes.Buffer).String())
+		}
+		Expect(msgs).To(ConsistOf("noisy-2", "noisy-3", "quiet-1"))
+		Expect(q.drops()).To(Equal(map[string]int64{"noisy": 2}))
+	})
+
+	It("forgets namespaces once their queues are empty", func() {
+		q := newFairQueue(10, nil, overflow{policy: OverflowDropNewest})
+		q.push("ns1", msg("some-log"))
+		q.push("ns2", msg("some-log"))
+		q.push("ns2", msg("some-log"))
+
+		for i := 0; i < 3; i++ {
+			Expect(q.pop()).ToNot(BeNil())
+		}
+		Expect(q.queues).To(BeEmpty())
+		Expect(q.active).To(BeEmpty())
+		Expect(q.total).To(BeZero())
+	})
+
+	It("limits the number of namespaces it counts drops for", func() {
+		q := newFairQueue(0, nil, overflow{policy: OverflowDropNewest})
+
+		for i := 0; i < maxDropNamespaces+10; i++ {
+			q.push(fmt.Sprintf("ns%d", i), msg("some-log"))
+		}
+		drops := q.drops()
+		Expect(drops).To(HaveLen(maxDropNamespaces + 1))
+		Expect(drops[otherNamespaces]).To(Equal(int64(10)))
+	})
+})
+
+var _ = Describe("chanQueue", func() {
+	It("accounts for every message when producers drop the oldest concurrently", func() {
+		for run := 0; run < 2000; run++ {
+			q := newChanQueue(2, overflow{policy: OverflowDropOldest})
+
+			var dropped int64
+			var producers sync.WaitGroup
+			for p := 0; p < 4; p++ {
+				producers.Add(1)
+				go func() {
+					defer producers.Done()
+					for i := 0; i < 50; i++ {
+						if !q.push("ns1", bytes.NewBufferString("some-log")) {
+							atomic.AddInt64(&dropped, 1)
+						}
+					}
+				}()
+			}
+
+			var delivered int64
+			consumed := make(chan struct{})
+			go func() {
+				defer close(consumed)
+				for q.pop() != nil {
+					delivered++
+				}
+			}()
+
+			producers.Wait()
+			q.close()
+			<-consumed
+			Expect(delivered+atomic.LoadInt64(&dropped)).To(Equal(int64(200)), fmt.Sprintf("run %d", run))
+		}
+	})
+})
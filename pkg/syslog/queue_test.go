@@ -0,0 +1,201 @@
+package syslog_test
+
+import (
+	"bufio"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Cluster sink queues", func() {
+	// newStalledOut returns an Out whose only cluster sink is stuck in the
+	// TLS handshake with the first message until the spy sink accepts the
+	// connection, so that the messages written meanwhile are queued.
+	newStalledOut := func(spySink *spySink, weights map[string]int) *syslog.Out {
+		s := &syslog.Sink{
+			Addr:             spySink.url(),
+			Name:             "cluster-sink",
+			TLS:              &syslog.TLS{InsecureSkipVerify: true},
+			NamespaceWeights: weights,
+		}
+		return syslog.NewOut(nil, []*syslog.Sink{s})
+	}
+
+	It("does not let one namespace starve the others", func() {
+		spySink := newTLSSpySink()
+		defer spySink.stop()
+		out := newStalledOut(spySink, nil)
+
+		for i := 0; i < 50; i++ {
+			out.Write(podRecord("noisy", "pod-name", fmt.Sprintf("noisy-%d", i)), time.Unix(0, 0).UTC(), "pod.log")
+		}
+		out.Write(podRecord("quiet", "pod-name", "quiet"), time.Unix(0, 0).UTC(), "pod.log")
+
+		conn := spySink.accept()
+		defer conn.Close()
+		buf := bufio.NewReader(conn)
+
+		var position int
+		for i := 0; i < 51; i++ {
+			var msg rfc5424.Message
+			_, err := msg.ReadFrom(buf)
+			Expect(err).ToNot(HaveOccurred())
+			if string(msg.Message) == "quiet\n" {
+				position = i
+				break
+			}
+		}
+		Expect(position).To(BeNumerically("<", 5))
+	})
+
+	It("drops messages only for the namespace that overflows its queue", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr: spySink.url(),
+			Name: "cluster-sink",
+		}
+		out := syslog.NewOut(
+			nil,
+			[]*syslog.Sink{s},
+			syslog.WithBufferSize(10),
+		)
+
+		for i := 0; i < 1000; i++ {
+			out.Write(podRecord("noisy", "pod-name", "noisy"), time.Unix(0, 0).UTC(), "pod.log")
+		}
+		out.Write(podRecord("quiet", "pod-name", "quiet"), time.Unix(0, 0).UTC(), "pod.log")
+
+		states := out.SinkState()
+		Expect(states).To(HaveLen(1))
+		Expect(states[0].NamespaceDrops["noisy"]).To(BeNumerically(">", 0))
+		Expect(states[0].NamespaceDrops).ToNot(HaveKey("quiet"))
+		Expect(s.MessagesDropped()).To(Equal(states[0].NamespaceDrops["noisy"]))
+	})
+
+	It("drains namespaces according to their weights", func() {
+		spySink := newTLSSpySink()
+		defer spySink.stop()
+		out := newStalledOut(spySink, map[string]int{"heavy": 3})
+
+		for i := 0; i < 50; i++ {
+			out.Write(podRecord("light", "pod-name", "light"), time.Unix(0, 0).UTC(), "pod.log")
+		}
+		for i := 0; i < 50; i++ {
+			out.Write(podRecord("heavy", "pod-name", "heavy"), time.Unix(0, 0).UTC(), "pod.log")
+		}
+
+		conn := spySink.accept()
+		defer conn.Close()
+		buf := bufio.NewReader(conn)
+
+		counts := make(map[string]int)
+		for i := 0; i < 41; i++ {
+			var msg rfc5424.Message
+			_, err := msg.ReadFrom(buf)
+			Expect(err).ToNot(HaveOccurred())
+			counts[string(msg.Message)]++
+		}
+		Expect(counts["heavy\n"]).To(BeNumerically(">", 2*counts["light\n"]))
+	})
+})
+
+var _ = Describe("Overflow policies", func() {
+	// newOut returns an Out whose only sink is stuck in the TLS handshake
+	// with the first message until the spy sink accepts the connection.
+	newOut := func(spySink *spySink, cluster bool, policy syslog.OverflowPolicy, timeout time.Duration) (*syslog.Out, *syslog.Sink) {
+		s := &syslog.Sink{
+			Addr:            spySink.url(),
+			Namespace:       "ns1",
+			TLS:             &syslog.TLS{InsecureSkipVerify: true},
+			QueueSize:       2,
+			OverflowPolicy:  policy,
+			OverflowTimeout: timeout,
+		}
+		if cluster {
+			return syslog.NewOut(nil, []*syslog.Sink{s}), s
+		}
+		return syslog.NewOut([]*syslog.Sink{s}, nil), s
+	}
+
+	writeAll := func(out *syslog.Out, msgs ...string) {
+		for _, m := range msgs {
+			out.Write(record(m), time.Unix(0, 0).UTC(), "pod.log")
+			// Give the sink a chance to pick up the first message.
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	for _, cluster := range []bool{false, true} {
+		cluster := cluster
+		Context(fmt.Sprintf("cluster sink: %t", cluster), func() {
+			It("drops the newest messages by default", func() {
+				spySink := newTLSSpySink()
+				defer spySink.stop()
+				out, s := newOut(spySink, cluster, "", 0)
+
+				writeAll(out, "1", "2", "3", "4", "5")
+
+				spySink.expectReceivedWithBody("1\n", "2\n", "3\n")
+				Expect(s.MessagesDropped()).To(Equal(int64(2)))
+			})
+
+			It("drops the oldest messages", func() {
+				spySink := newTLSSpySink()
+				defer spySink.stop()
+				out, s := newOut(spySink, cluster, syslog.OverflowDropOldest, 0)
+
+				writeAll(out, "1", "2", "3", "4", "5")
+
+				spySink.expectReceivedWithBody("1\n", "4\n", "5\n")
+				Expect(s.MessagesDropped()).To(Equal(int64(2)))
+			})
+
+			It("blocks for the overflow timeout before dropping", func() {
+				spySink := newTLSSpySink()
+				defer spySink.stop()
+				out, s := newOut(spySink, cluster, syslog.OverflowBlock, 200*time.Millisecond)
+
+				writeAll(out, "1", "2", "3")
+				start := time.Now()
+				writeAll(out, "4")
+				Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+
+				spySink.expectReceivedWithBody("1\n", "2\n", "3\n")
+				Expect(s.MessagesDropped()).To(Equal(int64(1)))
+			})
+
+			It("queues blocked messages once there is room", func() {
+				spySink := newTLSSpySink()
+				defer spySink.stop()
+				out, s := newOut(spySink, cluster, syslog.OverflowBlock, 5*time.Second)
+
+				writeAll(out, "1", "2", "3")
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					writeAll(out, "4")
+				}()
+				Consistently(done, 100*time.Millisecond).ShouldNot(BeClosed())
+
+				spySink.expectReceivedWithBody("1\n", "2\n", "3\n", "4\n")
+				Eventually(done).Should(BeClosed())
+				Expect(s.MessagesDropped()).To(BeZero())
+			})
+		})
+	}
+
+	It("parses overflow policies", func() {
+		for _, p := range []string{"", "drop-newest", "drop-oldest", "block"} {
+			_, err := syslog.ParseOverflowPolicy(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		_, err := syslog.ParseOverflowPolicy("drop-random")
+		Expect(err).To(HaveOccurred())
+	})
+})
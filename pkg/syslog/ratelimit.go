@@ -0,0 +1,276 @@
+package syslog
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+const defaultSuppressionReportInterval = 10 * time.Second
+
+// RateLimit configures token bucket limits on the number of messages and
+// message body bytes per second. A rate of zero disables the respective
+// limit. Bursts default to one second worth of the rate.
+type RateLimit struct {
+	MessagesPerSecond float64 `json:"messages_per_second"`
+	MessageBurst      int     `json:"message_burst"`
+	BytesPerSecond    float64 `json:"bytes_per_second"`
+	ByteBurst         int     `json:"byte_burst"`
+}
+
+// WithSuppressionReportInterval configures how often sinks that suppressed
+// messages due to rate limiting send a summary of the suppressed messages.
+// Intervals that are not positive keep the default of 10 seconds.
+func WithSuppressionReportInterval(d time.Duration) OutOption {
+	return func(o *Out) {
+		if d <= 0 {
+			d = defaultSuppressionReportInterval
+		}
+		o.suppressionReportInterval = d
+	}
+}
+
+// MessagesSuppressed returns the number of messages the sink did not send
+// because they exceeded its rate limits.
+func (s *Sink) MessagesSuppressed() int64 {
+	return atomic.LoadInt64(&s.messagesSuppressed)
+}
+
+// tokenBucket allows up to rate tokens per second, with up to burst tokens
+// accumulated while idle.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if b <= 0 {
+		b = rate
+	}
+	if b < 1 {
+		b = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  b,
+		tokens: b,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// cost caps n at the burst size so that a single large message can not
+// exceed the bucket forever.
+func (b *tokenBucket) cost(n float64) float64 {
+	if n > b.burst {
+		return b.burst
+	}
+	return n
+}
+
+// limits holds the message and byte buckets of a single RateLimit.
+type limits struct {
+	messages *tokenBucket
+	bytes    *tokenBucket
+}
+
+func newLimits(rl *RateLimit) *limits {
+	if rl == nil {
+		return nil
+	}
+	l := &limits{
+		messages: newTokenBucket(rl.MessagesPerSecond, rl.MessageBurst),
+		bytes:    newTokenBucket(rl.BytesPerSecond, rl.ByteBurst),
+	}
+	if l.messages == nil && l.bytes == nil {
+		return nil
+	}
+	return l
+}
+
+func (l *limits) available(now time.Time, size int) bool {
+	if l == nil {
+		return true
+	}
+	if l.messages != nil {
+		l.messages.refill(now)
+		if l.messages.tokens < 1 {
+			return false
+		}
+	}
+	if l.bytes != nil {
+		l.bytes.refill(now)
+		if l.bytes.tokens < l.bytes.cost(float64(size)) {
+			return false
+		}
+	}
+	return true
+}
+
+// full reports whether all buckets are full, in which case the limits
+// behave like new ones.
+func (l *limits) full(now time.Time) bool {
+	if l == nil {
+		return true
+	}
+	for _, b := range []*tokenBucket{l.messages, l.bytes} {
+		if b == nil {
+			continue
+		}
+		b.refill(now)
+		if b.tokens < b.burst {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *limits) take(size int) {
+	if l == nil {
+		return
+	}
+	if l.messages != nil {
+		l.messages.tokens--
+	}
+	if l.bytes != nil {
+		l.bytes.tokens -= l.bytes.cost(float64(size))
+	}
+}
+
+// rateLimiter enforces a sink's overall and per source namespace limits and
+// keeps track of suppressed messages per namespace until they are reported.
+type rateLimiter struct {
+	namespace *RateLimit
+
+	mu         sync.Mutex
+	total      *limits
+	namespaces map[string]*limits
+	suppressed map[string]int64
+}
+
+func newRateLimiter(sink, namespace *RateLimit) *rateLimiter {
+	if newLimits(sink) == nil && newLimits(namespace) == nil {
+		return nil
+	}
+	return &rateLimiter{
+		namespace:  namespace,
+		total:      newLimits(sink),
+		namespaces: make(map[string]*limits),
+		suppressed: make(map[string]int64),
+	}
+}
+
+// allow reports whether a message of the given body size from namespace is
+// within the limits, and consumes tokens if it is.
+func (r *rateLimiter) allow(namespace string, size int) bool {
+	if r == nil {
+		return true
+	}
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ns, ok := r.namespaces[namespace]
+	if !ok {
+		ns = newLimits(r.namespace)
+		r.namespaces[namespace] = ns
+	}
+
+	if !r.total.available(now, size) || !ns.available(now, size) {
+		r.suppressed[namespace]++
+		return false
+	}
+	r.total.take(size)
+	ns.take(size)
+	return true
+}
+
+// report returns and resets the suppressed message counts per namespace.
+// The limits of namespaces whose buckets have refilled are dropped, so that
+// only namespaces that sent messages recently are kept track of.
+func (r *rateLimiter) report() map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for ns, l := range r.namespaces {
+		if l.full(now) {
+			delete(r.namespaces, ns)
+		}
+	}
+
+	if len(r.suppressed) == 0 {
+		return nil
+	}
+	suppressed := r.suppressed
+	r.suppressed = make(map[string]int64)
+	return suppressed
+}
+
+// startSuppressionReports periodically queues a summary message for every
+// namespace that had messages suppressed since the last report.
+func (s *Sink) startSuppressionReports(interval time.Duration) {
+	if s.limiter == nil {
+		return
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for range t.C {
+			s.reportSuppressed()
+		}
+	}()
+}
+
+func (s *Sink) reportSuppressed() {
+	suppressed := s.limiter.report()
+	namespaces := make([]string, 0, len(suppressed))
+	for ns := range suppressed {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	for _, ns := range namespaces {
+		s.enqueue(suppressionMessage(ns, suppressed[ns], time.Now()), source{namespace: ns})
+	}
+}
+
+func suppressionMessage(namespace string, n int64, ts time.Time) io.WriterTo {
+	return &rfc5424.Message{
+		Priority:  rfc5424.Warning + rfc5424.User,
+		Timestamp: ts,
+		AppName:   "out_syslog",
+		Message:   []byte(fmt.Sprintf("%d messages suppressed for namespace %s\n", n, namespace)),
+		StructuredData: []rfc5424.StructuredData{
+			{
+				ID: "kubernetes@47450",
+				Parameters: []rfc5424.SDParam{
+					{
+						Name:  "namespace_name",
+						Value: namespace,
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,55 @@
+package syslog
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithSuppressionReportInterval", func() {
+	It("keeps the default report interval for intervals that are not positive", func() {
+		for _, d := range []time.Duration{0, -time.Second} {
+			o := &Out{}
+			WithSuppressionReportInterval(d)(o)
+			Expect(o.suppressionReportInterval).To(Equal(defaultSuppressionReportInterval), d.String())
+		}
+	})
+
+	It("uses positive intervals", func() {
+		o := &Out{}
+		WithSuppressionReportInterval(time.Minute)(o)
+		Expect(o.suppressionReportInterval).To(Equal(time.Minute))
+	})
+})
+
+var _ = Describe("rateLimiter", func() {
+	It("forgets namespaces whose buckets have refilled", func() {
+		r := newRateLimiter(nil, &RateLimit{
+			MessagesPerSecond: 1000,
+			MessageBurst:      1,
+		})
+
+		Expect(r.allow("ns1", 10)).To(BeTrue())
+		Expect(r.allow("ns2", 10)).To(BeTrue())
+		Expect(r.namespaces).To(HaveLen(2))
+
+		time.Sleep(10 * time.Millisecond)
+		r.report()
+		Expect(r.namespaces).To(BeEmpty())
+	})
+
+	It("keeps namespaces that are still limited", func() {
+		r := newRateLimiter(nil, &RateLimit{
+			MessagesPerSecond: 0.001,
+			MessageBurst:      1,
+		})
+
+		Expect(r.allow("ns1", 10)).To(BeTrue())
+		Expect(r.allow("ns1", 10)).To(BeFalse())
+
+		Expect(r.report()).To(Equal(map[string]int64{"ns1": 1}))
+		Expect(r.namespaces).To(HaveKey("ns1"))
+		Expect(r.report()).To(BeNil())
+	})
+})
@@ -0,0 +1,102 @@
+package syslog_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("RateLimit", func() {
+	It("suppresses messages above the sink's message rate", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr: spySink.url(),
+			RateLimit: &syslog.RateLimit{
+				MessagesPerSecond: 0.001,
+				MessageBurst:      2,
+			},
+		}
+		out := syslog.NewOut(nil, []*syslog.Sink{s})
+
+		for i := 0; i < 5; i++ {
+			out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+		}
+
+		spySink.expectReceivedOnly(
+			`<14>1 1970-01-01T00:00:00+00:00 - pod.log/ns1/pod-name/container-name - - [kubernetes@47450 namespace_name="ns1" object_name="pod-name" container_name="container-name"] some-log`+"\n",
+			`<14>1 1970-01-01T00:00:00+00:00 - pod.log/ns1/pod-name/container-name - - [kubernetes@47450 namespace_name="ns1" object_name="pod-name" container_name="container-name"] some-log`+"\n",
+		)
+		Expect(s.MessagesSuppressed()).To(Equal(int64(3)))
+	})
+
+	It("suppresses messages above the sink's byte rate", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr: spySink.url(),
+			RateLimit: &syslog.RateLimit{
+				BytesPerSecond: 0.001,
+				ByteBurst:      20,
+			},
+		}
+		out := syslog.NewOut(nil, []*syslog.Sink{s})
+
+		out.Write(record(strings.Repeat("x", 15)), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record(strings.Repeat("y", 15)), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody(strings.Repeat("x", 15) + "\n")
+		Expect(s.MessagesSuppressed()).To(Equal(int64(1)))
+	})
+
+	It("limits each source namespace separately", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr: spySink.url(),
+			NamespaceRateLimit: &syslog.RateLimit{
+				MessagesPerSecond: 0.001,
+				MessageBurst:      1,
+			},
+		}
+		out := syslog.NewOut(nil, []*syslog.Sink{s})
+
+		out.Write(podRecord("noisy", "pod-name", "noisy-1"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(podRecord("noisy", "pod-name", "noisy-2"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(podRecord("noisy", "pod-name", "noisy-3"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(podRecord("quiet", "pod-name", "quiet-1"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("noisy-1\n", "quiet-1\n")
+		Expect(s.MessagesSuppressed()).To(Equal(int64(2)))
+	})
+
+	It("periodically reports suppressed messages to the sink", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr: spySink.url(),
+			NamespaceRateLimit: &syslog.RateLimit{
+				MessagesPerSecond: 0.001,
+				MessageBurst:      1,
+			},
+		}
+		out := syslog.NewOut(
+			nil,
+			[]*syslog.Sink{s},
+			syslog.WithSuppressionReportInterval(100*time.Millisecond),
+		)
+
+		for i := 0; i < 4; i++ {
+			out.Write(podRecord("noisy", "pod-name", "noisy"), time.Unix(0, 0).UTC(), "pod.log")
+		}
+
+		spySink.expectReceivedWithBody(
+			"noisy\n",
+			"3 messages suppressed for namespace noisy\n",
+		)
+	})
+})
@@ -0,0 +1,213 @@
+package syslog
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+// RedactionRule replaces every match of Pattern in a message body or
+// structured data value with Replacement. Replacement may reference
+// submatches of Pattern as described by regexp.Regexp.Expand.
+type RedactionRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+
+	// valid optionally filters matches, e.g. to only redact numbers that
+	// pass a checksum.
+	valid func([]byte) bool
+}
+
+var builtinRedactionRules = map[string]RedactionRule{
+	"email": {
+		Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		Replacement: "[REDACTED:email]",
+	},
+	"credit_card": {
+		Pattern:     regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		Replacement: "[REDACTED:credit_card]",
+		valid:       luhnValid,
+	},
+	"bearer_token": {
+		Pattern:     regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/-]+=*`),
+		Replacement: "${1}[REDACTED]",
+	},
+	"jwt": {
+		Pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+		Replacement: "[REDACTED:jwt]",
+	},
+	"aws_access_key": {
+		Pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		Replacement: "[REDACTED:aws_access_key]",
+	},
+	"password": {
+		Pattern:     regexp.MustCompile(`(?i)((?:password|passwd|pwd|secret|api_?key)\s*[=:]\s*)("[^"]*"|\S+)`),
+		Replacement: "${1}[REDACTED]",
+	},
+}
+
+// BuiltinRedactionRules returns the built in rules for detecting common
+// secrets by name. Supported names are email, credit_card, bearer_token, jwt,
+// aws_access_key and password.
+func BuiltinRedactionRules(names ...string) ([]RedactionRule, error) {
+	rules := make([]RedactionRule, 0, len(names))
+	for _, n := range names {
+		r, ok := builtinRedactionRules[n]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction detector %q", n)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// WithRedaction configures rules that are applied to every message before
+// it is routed to any sink.
+func WithRedaction(rules ...RedactionRule) OutOption {
+	return func(o *Out) {
+		o.redactor = newRedactor(rules)
+	}
+}
+
+// Redactions returns the number of redactions performed by the rules
+// configured via WithRedaction.
+func (o *Out) Redactions() int64 {
+	return o.redactor.redactions()
+}
+
+// Redactions returns the number of redactions performed by the sink's own
+// redaction rules.
+func (s *Sink) Redactions() int64 {
+	return s.redactor.redactions()
+}
+
+type redactor struct {
+	rules []RedactionRule
+	count int64
+}
+
+func newRedactor(rules []RedactionRule) *redactor {
+	if len(rules) == 0 {
+		return nil
+	}
+	return &redactor{rules: rules}
+}
+
+func (r *redactor) redactions() int64 {
+	if r == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&r.count)
+}
+
+// redact returns msg with all rules applied to its body and structured data
+// values. msg itself is never modified since it may be shared between
+// sinks; a copy is returned if anything was redacted.
+func (r *redactor) redact(msg *rfc5424.Message) *rfc5424.Message {
+	if r == nil {
+		return msg
+	}
+
+	var total int
+	body, n := r.apply(msg.Message)
+	total += n
+
+	var sds []rfc5424.StructuredData
+	for i, sd := range msg.StructuredData {
+		var params []rfc5424.SDParam
+		for j, p := range sd.Parameters {
+			v, n := r.apply([]byte(p.Value))
+			if n == 0 {
+				continue
+			}
+			total += n
+			if params == nil {
+				params = append([]rfc5424.SDParam(nil), sd.Parameters...)
+			}
+			params[j].Value = string(v)
+		}
+		if params == nil {
+			continue
+		}
+		if sds == nil {
+			sds = append([]rfc5424.StructuredData(nil), msg.StructuredData...)
+		}
+		sds[i].Parameters = params
+	}
+
+	if total == 0 {
+		return msg
+	}
+	atomic.AddInt64(&r.count, int64(total))
+
+	m := *msg
+	m.Message = body
+	if sds != nil {
+		m.StructuredData = sds
+	}
+	return &m
+}
+
+func (r *redactor) apply(b []byte) ([]byte, int) {
+	var total int
+	for _, rule := range r.rules {
+		var n int
+		b, n = rule.apply(b)
+		total += n
+	}
+	return b, total
+}
+
+// apply replaces the matches of the rule in b. Replacements are expanded
+// from the submatches found in all of b, as matching an isolated match
+// again finds different submatches for patterns with anchors or word
+// boundaries.
+func (r RedactionRule) apply(b []byte) ([]byte, int) {
+	var (
+		out  []byte
+		last int
+		n    int
+	)
+	for _, idx := range r.Pattern.FindAllSubmatchIndex(b, -1) {
+		if r.valid != nil && !r.valid(b[idx[0]:idx[1]]) {
+			continue
+		}
+		out = append(out, b[last:idx[0]]...)
+		out = r.Pattern.Expand(out, []byte(r.Replacement), b, idx)
+		last = idx[1]
+		n++
+	}
+	if n == 0 {
+		return b, 0
+	}
+	return append(out, b[last:]...), n
+}
+
+// luhnValid reports whether the digits in b pass the Luhn checksum used by
+// credit card numbers. Other characters are ignored.
+func luhnValid(b []byte) bool {
+	var (
+		sum    int
+		digits int
+		double bool
+	)
+	for i := len(b) - 1; i >= 0; i-- {
+		c := b[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+		double = !double
+	}
+	return digits >= 13 && sum%10 == 0
+}
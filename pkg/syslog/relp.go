@@ -0,0 +1,488 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Protocol determines how a sink transports messages.
+type Protocol string
+
+const (
+	// ProtocolSyslog writes octet counted messages as described in RFC 6587
+	// without acknowledgements.
+	ProtocolSyslog Protocol = "syslog"
+	// ProtocolRELP uses the Reliable Event Logging Protocol. Messages stay
+	// queued until the receiver acknowledges them and are sent again over
+	// a new connection if it does not.
+	ProtocolRELP Protocol = "relp"
+)
+
+const (
+	defaultRELPWindow = 128
+	relpMaxTxnr       = 999999999
+	relpOffers        = "relp_version=0\nrelp_software=out_syslog\ncommands=syslog"
+	// relpResendInterval is how often a sink waiting for messages checks
+	// for frames an ended session did not acknowledge and sends them again.
+	relpResendInterval = 500 * time.Millisecond
+
+	// RELP limits TXNR and DATALEN to 9 digits and COMMAND to 32
+	// characters. The receiver only sends short responses, so larger
+	// frames are rejected rather than buffered.
+	relpMaxDigits      = 9
+	relpMaxCommand     = 32
+	relpMaxFrameLength = 64 * 1024
+)
+
+// ParseProtocol returns the Protocol for the given configuration value. An
+// empty value results in ProtocolSyslog.
+func ParseProtocol(s string) (Protocol, error) {
+	switch p := Protocol(s); p {
+	case "":
+		return ProtocolSyslog, nil
+	case ProtocolSyslog, ProtocolRELP:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown protocol %q", s)
+}
+
+var errRELPClosed = errors.New("relp: connection closed by receiver")
+
+// relpClient keeps the messages of a sink that have not been acknowledged
+// across RELP sessions. Frames are only written from the sink's goroutine;
+// acknowledgements are read by a goroutine per session.
+type relpClient struct {
+	window  int
+	sent    *int64
+	dropped *int64
+
+	mu      sync.Mutex
+	session *relpSession
+	unacked []*relpFrame
+	// acked is signaled whenever a frame is acknowledged.
+	acked chan struct{}
+}
+
+// relpSession is a RELP session on a single connection.
+type relpSession struct {
+	conn net.Conn
+	next int
+	done chan struct{}
+}
+
+type relpFrame struct {
+	data    []byte
+	txnr    int
+	session *relpSession
+}
+
+// relpConn is a connection on which the RELP session has been opened. r
+// holds anything the receiver sent after its response to the open command.
+type relpConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func newRELPClient(s *Sink) *relpClient {
+	c := &relpClient{
+		window:  s.RELPWindow,
+		sent:    &s.messagesSent,
+		dropped: &s.messagesDropped,
+		acked:   make(chan struct{}, 1),
+	}
+	if c.window <= 0 {
+		c.window = defaultRELPWindow
+	}
+	return c
+}
+
+// dial returns a dial function that opens a RELP session on the
+// connections returned by dial.
+func (c *relpClient) dial(dial func(string) (net.Conn, error), timeout time.Duration) func(string) (net.Conn, error) {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		r, err := relpOpen(conn, timeout)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &relpConn{Conn: conn, r: r}, nil
+	}
+}
+
+// relpOpen sends the open command and waits for the receiver to accept it.
+func relpOpen(conn net.Conn, timeout time.Duration) (*bufio.Reader, error) {
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	defer func() {
+		_ = conn.SetDeadline(time.Time{})
+	}()
+
+	_, err := conn.Write(relpFrameBytes(1, "open", []byte(relpOffers)))
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	txnr, cmd, data, err := readRELPFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	if txnr != 1 || cmd != "rsp" || !bytes.HasPrefix(data, []byte("200")) {
+		return nil, fmt.Errorf("relp: open rejected: %d %s %q", txnr, cmd, data)
+	}
+	return r, nil
+}
+
+// attach starts a session on conn, which must have been returned by the
+// client's dial function. Frames that were not acknowledged in a previous
+// session are sent again before the next message. closed is set once the
+// receiver closes the connection.
+func (c *relpClient) attach(conn net.Conn, closed *int32) {
+	// The open command used transaction number 1.
+	sess := &relpSession{
+		conn: conn,
+		next: 2,
+		done: make(chan struct{}),
+	}
+	c.mu.Lock()
+	c.session = sess
+	c.mu.Unlock()
+
+	r, ok := conn.(*relpConn)
+	if !ok {
+		r = &relpConn{Conn: conn, r: bufio.NewReader(conn)}
+	}
+	go c.readResponses(sess, r.r, closed)
+}
+
+// readResponses handles the receiver's responses until the session ends.
+func (c *relpClient) readResponses(sess *relpSession, r *bufio.Reader, closed *int32) {
+	defer func() {
+		atomic.StoreInt32(closed, 1)
+		close(sess.done)
+	}()
+
+	for {
+		txnr, cmd, data, err := readRELPFrame(r)
+		if err != nil {
+			return
+		}
+		switch cmd {
+		case "rsp":
+			c.ack(sess, txnr, data)
+		case "serverclose":
+			return
+		}
+	}
+}
+
+// ack removes the frame with txnr from the unacknowledged frames. Frames
+// the receiver accepted are counted as sent, those it refused as dropped.
+func (c *relpClient) ack(sess *relpSession, txnr int, data []byte) {
+	c.mu.Lock()
+	for i, f := range c.unacked {
+		if f.session == sess && f.txnr == txnr {
+			c.unacked = append(c.unacked[:i], c.unacked[i+1:]...)
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if bytes.HasPrefix(data, []byte("200")) {
+		atomic.AddInt64(c.sent, 1)
+	} else {
+		atomic.AddInt64(c.dropped, 1)
+		log.Printf("[out_syslog] RELP receiver refused message: %s\n", data)
+	}
+	select {
+	case c.acked <- struct{}{}:
+	default:
+	}
+}
+
+// send writes w as a syslog command once there is room in the window,
+// after sending the frames a previous session did not acknowledge.
+func (c *relpClient) send(w io.WriterTo, timeout time.Duration) error {
+	m, ok := w.(encoding.BinaryMarshaler)
+	if !ok {
+		return fmt.Errorf("relp: unsupported message type %T", w)
+	}
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	err = c.resend()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	sess := c.session
+	c.mu.Unlock()
+	err = c.waitForWindow(sess, timeout)
+	if err != nil {
+		return err
+	}
+	f := &relpFrame{data: data}
+	c.mu.Lock()
+	c.unacked = append(c.unacked, f)
+	c.mu.Unlock()
+
+	err = c.writeFrame(sess, f)
+	if err != nil {
+		// The caller handles the failed message.
+		c.remove(f)
+	}
+	return err
+}
+
+// resend writes the frames a previous session did not acknowledge to the
+// current session.
+func (c *relpClient) resend() error {
+	c.mu.Lock()
+	sess := c.session
+	var stale []*relpFrame
+	for _, f := range c.unacked {
+		if f.session != sess {
+			stale = append(stale, f)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, f := range stale {
+		err := c.writeFrame(sess, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stale reports whether frames wait to be sent again because the session
+// they were written to has ended.
+func (c *relpClient) stale() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range c.unacked {
+		if f.session != c.session {
+			return true
+		}
+		select {
+		case <-f.session.done:
+			return true
+		default:
+		}
+	}
+	return false
+}
+
+// resendRELP sends the frames an ended RELP session did not acknowledge
+// over a new connection.
+func (s *Sink) resendRELP() {
+	err := s.maintainConnection()
+	if err == nil {
+		_ = s.conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+		err = s.relp.resend()
+		if err != nil {
+			s.closeConn()
+			s.failover.writeFailed()
+		}
+	}
+	if err != nil {
+		s.writeErr.Store(SinkError{
+			Msg:       err.Error(),
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+// writeFrame numbers f for sess and writes it. The frame is numbered
+// before it is written so that the response can not arrive first.
+func (c *relpClient) writeFrame(sess *relpSession, f *relpFrame) error {
+	c.mu.Lock()
+	f.txnr = sess.nextTxnr()
+	f.session = sess
+	c.mu.Unlock()
+
+	_, err := sess.conn.Write(relpFrameBytes(f.txnr, "syslog", f.data))
+	return err
+}
+
+func (c *relpClient) remove(f *relpFrame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, u := range c.unacked {
+		if u == f {
+			c.unacked = append(c.unacked[:i], c.unacked[i+1:]...)
+			return
+		}
+	}
+}
+
+// waitForWindow waits until fewer frames than the window size are
+// unacknowledged.
+func (c *relpClient) waitForWindow(sess *relpSession, timeout time.Duration) error {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	for {
+		c.mu.Lock()
+		n := len(c.unacked)
+		c.mu.Unlock()
+		if n < c.window {
+			return nil
+		}
+
+		select {
+		case <-c.acked:
+		case <-sess.done:
+			return errRELPClosed
+		case <-t.C:
+			return errors.New("relp: timed out waiting for acknowledgements")
+		}
+	}
+}
+
+// close sends the close command to end the current session. It does not
+// wait for the response.
+func (c *relpClient) close(timeout time.Duration) {
+	c.mu.Lock()
+	sess := c.session
+	var txnr int
+	if sess != nil {
+		txnr = sess.nextTxnr()
+	}
+	c.mu.Unlock()
+	if sess == nil {
+		return
+	}
+
+	_ = sess.conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, _ = sess.conn.Write(relpFrameBytes(txnr, "close", nil))
+}
+
+// unackedCount returns the number of frames waiting for acknowledgement.
+func (c *relpClient) unackedCount() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.unacked)
+}
+
+// nextTxnr returns the next transaction number of the session. It must be
+// called with the client's lock held.
+func (s *relpSession) nextTxnr() int {
+	txnr := s.next
+	s.next++
+	if s.next > relpMaxTxnr {
+		s.next = 1
+	}
+	return txnr
+}
+
+func relpFrameBytes(txnr int, cmd string, data []byte) []byte {
+	b := make([]byte, 0, len(data)+len(cmd)+24)
+	b = strconv.AppendInt(b, int64(txnr), 10)
+	b = append(b, ' ')
+	b = append(b, cmd...)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(len(data)), 10)
+	if len(data) > 0 {
+		b = append(b, ' ')
+		b = append(b, data...)
+	}
+	return append(b, '\n')
+}
+
+// readRELPFrame reads a frame of the form TXNR SP COMMAND SP DATALEN
+// [SP DATA] TRAILER. Frames with more than relpMaxFrameLength bytes of data
+// are rejected.
+func readRELPFrame(r *bufio.Reader) (int, string, []byte, error) {
+	txnrB, end, err := readRELPToken(r, relpMaxDigits)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	txnr, err := strconv.Atoi(txnrB)
+	if err != nil || end != ' ' {
+		return 0, "", nil, fmt.Errorf("relp: invalid transaction number")
+	}
+	cmd, end, err := readRELPToken(r, relpMaxCommand)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	if end != ' ' {
+		return 0, "", nil, fmt.Errorf("relp: missing data length")
+	}
+
+	lengthB, end, err := readRELPToken(r, relpMaxDigits)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	length := 0
+	for _, b := range []byte(lengthB) {
+		if b < '0' || b > '9' {
+			return 0, "", nil, fmt.Errorf("relp: invalid data length")
+		}
+		length = length*10 + int(b-'0')
+	}
+	if end == '\n' {
+		if length != 0 {
+			return 0, "", nil, fmt.Errorf("relp: missing data")
+		}
+		return txnr, cmd, nil, nil
+	}
+	if length > relpMaxFrameLength {
+		return 0, "", nil, fmt.Errorf("relp: data length %d exceeds %d bytes", length, relpMaxFrameLength)
+	}
+
+	data := make([]byte, length+1)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	if data[length] != '\n' {
+		return 0, "", nil, fmt.Errorf("relp: missing trailer")
+	}
+	return txnr, cmd, data[:length], nil
+}
+
+// readRELPToken reads up to max bytes until a space or, for the data
+// length of frames without data, a line feed. It returns the token and the
+// byte that ended it.
+func readRELPToken(r *bufio.Reader, max int) (string, byte, error) {
+	var token []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", 0, err
+		}
+		if b == ' ' || b == '\n' {
+			if len(token) == 0 {
+				return "", 0, fmt.Errorf("relp: empty frame header field")
+			}
+			return string(token), b, nil
+		}
+		if len(token) == max {
+			return "", 0, fmt.Errorf("relp: frame header field exceeds %d bytes", max)
+		}
+		token = append(token, b)
+	}
+}
@@ -0,0 +1,45 @@
+package syslog
+
+import (
+	"bufio"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("readRELPFrame", func() {
+	read := func(frame string) (int, string, []byte, error) {
+		return readRELPFrame(bufio.NewReader(strings.NewReader(frame)))
+	}
+
+	It("reads frames with and without data", func() {
+		txnr, cmd, data, err := read("1 rsp 6 200 OK\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(txnr).To(Equal(1))
+		Expect(cmd).To(Equal("rsp"))
+		Expect(string(data)).To(Equal("200 OK"))
+
+		txnr, cmd, data, err = read("2 rsp 0\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(txnr).To(Equal(2))
+		Expect(cmd).To(Equal("rsp"))
+		Expect(data).To(BeNil())
+	})
+
+	DescribeTable("rejects invalid frames",
+		func(frame, msg string) {
+			_, _, _, err := read(frame)
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("DATALEN over 9 digits", "1 rsp 9999999999 x\n", "exceeds 9 bytes"),
+		Entry("DATALEN that would overflow", "1 rsp 99999999999999999999 x\n", "exceeds 9 bytes"),
+		Entry("DATALEN over the maximum frame size", "1 rsp 999999999 x\n", "exceeds 65536 bytes"),
+		Entry("TXNR over 9 digits", "1234567890 rsp 0\n", "exceeds 9 bytes"),
+		Entry("command over 32 characters", "1 "+strings.Repeat("r", 33)+" 0\n", "exceeds 32 bytes"),
+		Entry("non-numeric DATALEN", "1 rsp 1x 2\n", "invalid data length"),
+		Entry("missing data", "1 rsp 5\n", "missing data"),
+		Entry("missing trailer", "1 rsp 2 OKK", "missing trailer"),
+	)
+})
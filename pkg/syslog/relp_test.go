@@ -0,0 +1,419 @@
+package syslog_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("RELP", func() {
+	unacked := func(out *syslog.Out) func() int {
+		return func() int {
+			return out.SinkState()[0].Unacked
+		}
+	}
+
+	It("sends messages and waits for acknowledgements", func() {
+		server := newRELPServer(false)
+		defer server.stop()
+		s := &syslog.Sink{
+			Addr:      server.url(),
+			Namespace: "ns1",
+			Protocol:  syslog.ProtocolRELP,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Eventually(server.received).Should(Equal([]string{"first\n", "second\n"}))
+		Eventually(unacked(out)).Should(BeZero())
+		Expect(server.offers()).To(ContainElement("commands=syslog"))
+		Expect(server.txnrs()).To(Equal([]int{2, 3}))
+		Expect(s.MessagesSent()).To(Equal(int64(2)))
+		Expect(s.MessagesDropped()).To(BeZero())
+	})
+
+	It("resends unacknowledged messages after reconnecting", func() {
+		server := newRELPServer(false)
+		defer server.stop()
+		server.setAck(false)
+		s := &syslog.Sink{
+			Addr:      server.url(),
+			Namespace: "ns1",
+			Protocol:  syslog.ProtocolRELP,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+		Eventually(server.received).Should(HaveLen(2))
+		Expect(unacked(out)()).To(Equal(2))
+
+		server.setAck(true)
+		server.closeConns()
+		time.Sleep(100 * time.Millisecond)
+		out.Write(record("third"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Eventually(server.received).Should(Equal([]string{
+			"first\n", "second\n",
+			"first\n", "second\n", "third\n",
+		}))
+		Eventually(unacked(out)).Should(BeZero())
+		Expect(s.MessagesDropped()).To(BeZero())
+	})
+
+	It("resends unacknowledged messages without waiting for new ones", func() {
+		server := newRELPServer(false)
+		defer server.stop()
+		server.setAck(false)
+		s := &syslog.Sink{
+			Addr:      server.url(),
+			Namespace: "ns1",
+			Protocol:  syslog.ProtocolRELP,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		Eventually(server.received).Should(HaveLen(1))
+
+		server.setAck(true)
+		server.closeConns()
+
+		Eventually(server.received, 3*time.Second).Should(Equal([]string{"first\n", "first\n"}))
+		Eventually(unacked(out)).Should(BeZero())
+		Expect(s.MessagesSent()).To(Equal(int64(1)))
+	})
+
+	It("flushes once the receiver acknowledged all messages", func() {
+		server := newRELPServer(false)
+		defer server.stop()
+		server.setAck(false)
+		s := &syslog.Sink{
+			Addr:      server.url(),
+			Namespace: "ns1",
+			Protocol:  syslog.ProtocolRELP,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+		Eventually(server.received).Should(HaveLen(1))
+		Expect(out.Flush(200 * time.Millisecond)).To(BeFalse())
+
+		server.ackPending()
+		Expect(out.Flush(time.Second)).To(BeTrue())
+		Expect(s.MessagesSent()).To(Equal(int64(1)))
+	})
+
+	It("waits for acknowledgements once the window is full", func() {
+		server := newRELPServer(false)
+		defer server.stop()
+		server.setAck(false)
+		s := &syslog.Sink{
+			Addr:       server.url(),
+			Namespace:  "ns1",
+			Protocol:   syslog.ProtocolRELP,
+			RELPWindow: 2,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		for _, msg := range []string{"first", "second", "third"} {
+			out.Write(record(msg), time.Unix(0, 0).UTC(), "pod.log")
+		}
+
+		Eventually(server.received).Should(HaveLen(2))
+		Consistently(server.received, 300*time.Millisecond).Should(HaveLen(2))
+
+		server.ackPending()
+		Eventually(server.received).Should(Equal([]string{"first\n", "second\n", "third\n"}))
+	})
+
+	It("counts refused messages as dropped", func() {
+		server := newRELPServer(false)
+		defer server.stop()
+		server.setRefuse(true)
+		s := &syslog.Sink{
+			Addr:      server.url(),
+			Namespace: "ns1",
+			Protocol:  syslog.ProtocolRELP,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Eventually(s.MessagesDropped).Should(Equal(int64(1)))
+		Expect(unacked(out)()).To(BeZero())
+		Expect(s.MessagesSent()).To(BeZero())
+	})
+
+	It("sends messages over TLS", func() {
+		server := newRELPServer(true)
+		defer server.stop()
+		s := &syslog.Sink{
+			Addr:      server.url(),
+			Namespace: "ns1",
+			Protocol:  syslog.ProtocolRELP,
+			TLS: &syslog.TLS{
+				InsecureSkipVerify: true,
+			},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Eventually(server.received).Should(Equal([]string{"some-log\n"}))
+		Eventually(unacked(out)).Should(BeZero())
+	})
+
+	It("parses protocols", func() {
+		p, err := syslog.ParseProtocol("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal(syslog.ProtocolSyslog))
+
+		p, err = syslog.ParseProtocol("relp")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal(syslog.ProtocolRELP))
+
+		_, err = syslog.ParseProtocol("udp")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// relpServer is a RELP receiver that records the bodies of the messages it
+// receives. It acknowledges messages unless told otherwise.
+type relpServer struct {
+	lis net.Listener
+
+	mu         sync.Mutex
+	ack        bool
+	refuse     bool
+	bodies     []string
+	txnrList   []int
+	offerList  []string
+	pending    []pendingAck
+	conns      []net.Conn
+	writeLocks map[net.Conn]*sync.Mutex
+}
+
+type pendingAck struct {
+	conn net.Conn
+	txnr int
+}
+
+func newRELPServer(useTLS bool) *relpServer {
+	var (
+		lis net.Listener
+		err error
+	)
+	if useTLS {
+		cert, err := tls.LoadX509KeyPair("./testdata/server.crt", "./testdata/server.key")
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		lis, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		})
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	} else {
+		lis, err = net.Listen("tcp", "127.0.0.1:0")
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	}
+
+	s := &relpServer{
+		lis:        lis,
+		ack:        true,
+		writeLocks: make(map[net.Conn]*sync.Mutex),
+	}
+	go s.serve()
+	return s
+}
+
+func (s *relpServer) url() string {
+	return s.lis.Addr().String()
+}
+
+func (s *relpServer) stop() {
+	_ = s.lis.Close()
+	s.closeConns()
+}
+
+func (s *relpServer) serve() {
+	for {
+		conn, err := s.lis.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.writeLocks[conn] = &sync.Mutex{}
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *relpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		txnr, cmd, data, err := readTestRELPFrame(r)
+		if err != nil {
+			return
+		}
+		switch cmd {
+		case "open":
+			s.mu.Lock()
+			s.offerList = append(s.offerList, splitLines(data)...)
+			s.mu.Unlock()
+			s.respond(conn, txnr, "200 OK\nrelp_version=0\ncommands=syslog")
+		case "syslog":
+			var msg rfc5424.Message
+			err := msg.UnmarshalBinary(data)
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.bodies = append(s.bodies, string(msg.Message))
+			s.txnrList = append(s.txnrList, txnr)
+			ack, refuse := s.ack, s.refuse
+			if !ack {
+				s.pending = append(s.pending, pendingAck{conn: conn, txnr: txnr})
+			}
+			s.mu.Unlock()
+			switch {
+			case refuse:
+				s.respond(conn, txnr, "500 refused")
+			case ack:
+				s.respond(conn, txnr, "200 OK")
+			}
+		case "close":
+			s.respond(conn, txnr, "")
+			return
+		}
+	}
+}
+
+func (s *relpServer) respond(conn net.Conn, txnr int, data string) {
+	s.mu.Lock()
+	l := s.writeLocks[conn]
+	s.mu.Unlock()
+	l.Lock()
+	defer l.Unlock()
+	if data == "" {
+		_, _ = fmt.Fprintf(conn, "%d rsp 0\n", txnr)
+		return
+	}
+	_, _ = fmt.Fprintf(conn, "%d rsp %d %s\n", txnr, len(data), data)
+}
+
+func (s *relpServer) setAck(ack bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ack = ack
+}
+
+func (s *relpServer) setRefuse(refuse bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refuse = refuse
+}
+
+// ackPending acknowledges the messages received so far and all following
+// messages.
+func (s *relpServer) ackPending() {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.ack = true
+	s.mu.Unlock()
+	for _, p := range pending {
+		s.respond(p.conn, p.txnr, "200 OK")
+	}
+}
+
+func (s *relpServer) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		_ = c.Close()
+	}
+	s.conns = nil
+	s.pending = nil
+}
+
+func (s *relpServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+func (s *relpServer) txnrs() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.txnrList...)
+}
+
+func (s *relpServer) offers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.offerList...)
+}
+
+func splitLines(data []byte) []string {
+	var lines []string
+	start := 0
+	for i, b := range data {
+		if b == '\n' {
+			lines = append(lines, string(data[start:i]))
+			start = i + 1
+		}
+	}
+	return append(lines, string(data[start:]))
+}
+
+func readTestRELPFrame(r *bufio.Reader) (int, string, []byte, error) {
+	txnrS, err := r.ReadString(' ')
+	if err != nil {
+		return 0, "", nil, err
+	}
+	txnr, err := strconv.Atoi(txnrS[:len(txnrS)-1])
+	if err != nil {
+		return 0, "", nil, err
+	}
+	cmd, err := r.ReadString(' ')
+	if err != nil {
+		return 0, "", nil, err
+	}
+	var lenS string
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, "", nil, err
+		}
+		if b == '\n' {
+			return txnr, cmd[:len(cmd)-1], nil, nil
+		}
+		if b == ' ' {
+			break
+		}
+		lenS += string(b)
+	}
+	length, err := strconv.Atoi(lenS)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	data := make([]byte, length+1)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	return txnr, cmd[:len(cmd)-1], data[:length], nil
+}
@@ -0,0 +1,224 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resolver looks up the addresses of sinks. It is implemented by
+// *net.Resolver.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// WithResolver configures the resolver used for SRV lookups and to resolve
+// the addresses of balancing sinks and of sinks that are re-resolved
+// periodically. It defaults to net.DefaultResolver.
+func WithResolver(r Resolver) OutOption {
+	return func(o *Out) {
+		o.resolver = r
+	}
+}
+
+// endpoint is an address to connect to and the host name it was resolved
+// from, which TLS connections verify.
+type endpoint struct {
+	addr string
+	host string
+}
+
+// lookupSRV returns the targets of the _syslog._tcp SRV records of domain
+// in the order returned by the resolver. *net.Resolver orders them by
+// priority and, randomly, by weight.
+func (o *Out) lookupSRV(domain string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), o.dialTimeout)
+	defer cancel()
+
+	_, srvs, err := o.resolver.LookupSRV(ctx, "syslog", "tcp", domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(srvs) == 0 {
+		return nil, fmt.Errorf("no SRV records found for %s", domain)
+	}
+	addrs := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		host := strings.TrimSuffix(srv.Target, ".")
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+	}
+	return addrs, nil
+}
+
+// resolveAll returns an endpoint for each A and AAAA record of the host in
+// hostport.
+func (o *Out) resolveAll(hostport string) ([]endpoint, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.dialTimeout)
+	defer cancel()
+	ips, err := o.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	eps := make([]endpoint, 0, len(ips))
+	for _, ip := range ips {
+		eps = append(eps, endpoint{
+			addr: net.JoinHostPort(ip, port),
+			host: host,
+		})
+	}
+	return eps, nil
+}
+
+// sinkAddrs returns the addresses a sink that does not balance connects to
+// in order of preference.
+func (o *Out) sinkAddrs(s *Sink) ([]string, error) {
+	addrs := []string{s.Addr}
+	if s.SRV != "" {
+		var err error
+		addrs, err = o.lookupSRV(s.SRV)
+		if err != nil {
+			return s.FailoverAddrs, err
+		}
+	}
+	return append(addrs, s.FailoverAddrs...), nil
+}
+
+// balanceEndpoints returns the endpoints of a balancing sink's pool. The
+// endpoints that could be resolved are returned along with the first error.
+func (o *Out) balanceEndpoints(s *Sink) ([]endpoint, error) {
+	var eps []endpoint
+	for _, addr := range s.BalanceAddrs {
+		eps = append(eps, endpoint{addr: addr})
+	}
+
+	var (
+		hosts    []string
+		firstErr error
+	)
+	if s.BalanceHost != "" {
+		hosts = append(hosts, s.BalanceHost)
+	}
+	if s.BalanceSRV != "" {
+		targets, err := o.lookupSRV(s.BalanceSRV)
+		if err != nil {
+			firstErr = err
+		}
+		hosts = append(hosts, targets...)
+	}
+	for _, h := range hosts {
+		resolved, err := o.resolveAll(h)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		eps = append(eps, resolved...)
+	}
+	return eps, firstErr
+}
+
+// balances reports whether s distributes its messages across a pool.
+func (s *Sink) balances() bool {
+	return len(s.BalanceAddrs) > 0 || s.BalanceHost != "" || s.BalanceSRV != ""
+}
+
+// rotation re-resolves the addresses of a sink that does not balance every
+// interval. It is only used from the sink's goroutine.
+type rotation struct {
+	interval    time.Duration
+	resolve     func() ([]string, string, error)
+	next        time.Time
+	fingerprint string
+}
+
+// newRotation returns a rotation for s or nil if s is not re-resolved.
+func (o *Out) newRotation(s *Sink) *rotation {
+	if s.ResolveInterval <= 0 {
+		return nil
+	}
+	r := &rotation{
+		interval: s.ResolveInterval,
+		resolve: func() ([]string, string, error) {
+			return o.resolveSink(s)
+		},
+		next: time.Now().Add(s.ResolveInterval),
+	}
+	_, r.fingerprint, _ = r.resolve()
+	return r
+}
+
+// resolveSink returns the addresses of s and a fingerprint of the IP
+// addresses they resolve to. Unix socket paths and drain URLs are not
+// resolved and are part of the fingerprint as they are.
+func (o *Out) resolveSink(s *Sink) ([]string, string, error) {
+	addrs, err := o.sinkAddrs(s)
+	if err != nil {
+		return nil, "", err
+	}
+	var ips []string
+	for _, addr := range addrs {
+		if network, _ := splitNetwork(addr); network != "tcp" || isHTTPAddr(addr) {
+			ips = append(ips, addr)
+			continue
+		}
+		eps, err := o.resolveAll(addr)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, ep := range eps {
+			ips = append(ips, ep.addr)
+		}
+	}
+	// Resolvers commonly rotate the order of records.
+	sort.Strings(ips)
+	return addrs, strings.Join(ips, ","), nil
+}
+
+// check returns the sink's addresses if the interval has passed and they
+// resolve differently than before.
+func (r *rotation) check(now time.Time) ([]string, bool) {
+	if r == nil || now.Before(r.next) {
+		return nil, false
+	}
+	r.next = now.Add(r.interval)
+
+	addrs, fingerprint, err := r.resolve()
+	if err != nil {
+		log.Printf("[out_syslog] Unable to resolve sink addresses: %s\n", err)
+		return nil, false
+	}
+	if fingerprint == r.fingerprint {
+		return nil, false
+	}
+	r.fingerprint = fingerprint
+	return addrs, true
+}
+
+// startPoolResolution updates the pool of s with its resolved endpoints
+// every ResolveInterval.
+func (o *Out) startPoolResolution(s *Sink) {
+	if s.ResolveInterval <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(s.ResolveInterval)
+		defer t.Stop()
+		for range t.C {
+			eps, err := o.balanceEndpoints(s)
+			if err != nil {
+				log.Printf("[out_syslog] Unable to resolve addresses of sink %s: %s\n", s.Name, err)
+				continue
+			}
+			s.pool.update(eps)
+		}
+	}()
+}
@@ -0,0 +1,20 @@
+package syslog
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("resolveSink", func() {
+	It("does not resolve unix socket paths and drain URLs", func() {
+		o := &Out{resolver: net.DefaultResolver}
+		for _, addr := range []string{"unix:///dev/log", "unixgram:///dev/log", "https://drain.example.com/logs"} {
+			addrs, fingerprint, err := o.resolveSink(&Sink{Addr: addr})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(addrs).To(Equal([]string{addr}))
+			Expect(fingerprint).To(Equal(addr))
+		}
+	})
+})
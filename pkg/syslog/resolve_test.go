@@ -0,0 +1,228 @@
+package syslog_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Resolve", func() {
+	srvFor := func(addrs ...string) []*net.SRV {
+		var srvs []*net.SRV
+		for _, addr := range addrs {
+			host, port, err := net.SplitHostPort(addr)
+			Expect(err).ToNot(HaveOccurred())
+			p, err := strconv.Atoi(port)
+			Expect(err).ToNot(HaveOccurred())
+			srvs = append(srvs, &net.SRV{
+				Target: host + ".",
+				Port:   uint16(p),
+			})
+		}
+		return srvs
+	}
+
+	activeAddrs := func(out *syslog.Out) func() []string {
+		return func() []string {
+			var addrs []string
+			for _, p := range out.SinkState()[0].Pool {
+				addrs = append(addrs, p.ActiveAddr)
+			}
+			return addrs
+		}
+	}
+
+	It("sends to the targets of SRV records in order", func() {
+		spySink := newSpySink("127.0.0.1:0")
+		defer spySink.stop()
+		unused := unusedAddr()
+		resolver := newSpyResolver()
+		resolver.setSRV("syslog.example.com", srvFor(unused, spySink.url()))
+		s := &syslog.Sink{
+			Namespace: "ns1",
+			SRV:       "syslog.example.com",
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil, syslog.WithResolver(resolver))
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("some-log\n")
+		Expect(out.SinkState()[0].ActiveAddr).To(Equal(spySink.url()))
+		Expect(resolver.srvLookups()).To(Equal([]string{"_syslog._tcp.syslog.example.com"}))
+	})
+
+	It("looks up SRV records again when the lookup at startup failed", func() {
+		spySink := newSpySink("127.0.0.1:0")
+		defer spySink.stop()
+		resolver := newSpyResolver()
+		resolver.setSRV("syslog.example.com", srvFor(spySink.url()))
+		resolver.failSRV(1)
+		s := &syslog.Sink{
+			Namespace: "ns1",
+			SRV:       "syslog.example.com",
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil, syslog.WithResolver(resolver))
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("some-log\n")
+		Expect(resolver.srvLookups()).To(HaveLen(2))
+		Expect(s.MessagesDropped()).To(BeZero())
+	})
+
+	It("reconnects when the addresses of a sink change", func() {
+		spyA := newSpySink("127.0.0.1:0")
+		defer spyA.stop()
+		spyB := newSpySink("127.0.0.1:0")
+		defer spyB.stop()
+		resolver := newSpyResolver()
+		resolver.setSRV("syslog.example.com", srvFor(spyA.url()))
+		s := &syslog.Sink{
+			Namespace:       "ns1",
+			SRV:             "syslog.example.com",
+			ResolveInterval: 100 * time.Millisecond,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil, syslog.WithResolver(resolver))
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		spyA.expectReceivedWithBody("first\n")
+
+		resolver.setSRV("syslog.example.com", srvFor(spyB.url()))
+		time.Sleep(100 * time.Millisecond)
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spyB.expectReceivedWithBody("second\n")
+		Expect(out.SinkState()[0].ActiveAddr).To(Equal(spyB.url()))
+	})
+
+	It("updates the pool of a balancing sink", func() {
+		spyA := newSpySink("127.0.0.1:0")
+		defer spyA.stop()
+		spyB := newSpySink("127.0.0.1:0")
+		defer spyB.stop()
+		resolver := newSpyResolver()
+		resolver.setSRV("pool.example.com", srvFor(spyA.url()))
+		s := &syslog.Sink{
+			Namespace:       "ns1",
+			BalanceSRV:      "pool.example.com",
+			ResolveInterval: 50 * time.Millisecond,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil, syslog.WithResolver(resolver))
+		Expect(activeAddrs(out)()).To(Equal([]string{spyA.url()}))
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		spyA.expectReceivedWithBody("first\n")
+
+		resolver.setSRV("pool.example.com", srvFor(spyB.url()))
+		Eventually(activeAddrs(out)).Should(Equal([]string{spyB.url()}))
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spyB.expectReceivedWithBody("second\n")
+		Expect(s.MessagesDropped()).To(BeZero())
+	})
+
+	It("resolves the pool again when resolving failed at startup", func() {
+		spySink := newSpySink("127.0.0.1:0")
+		defer spySink.stop()
+		resolver := newSpyResolver()
+		resolver.setSRV("pool.example.com", srvFor(spySink.url()))
+		resolver.failSRV(1)
+		s := &syslog.Sink{
+			Namespace:  "ns1",
+			BalanceSRV: "pool.example.com",
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil, syslog.WithResolver(resolver))
+		Expect(activeAddrs(out)()).To(BeEmpty())
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("some-log\n")
+		Expect(activeAddrs(out)()).To(Equal([]string{spySink.url()}))
+		Expect(s.MessagesDropped()).To(BeZero())
+	})
+
+	It("keeps the pool when resolving fails", func() {
+		spySink := newSpySink("127.0.0.1:0")
+		defer spySink.stop()
+		resolver := newSpyResolver()
+		resolver.setSRV("pool.example.com", srvFor(spySink.url()))
+		s := &syslog.Sink{
+			Namespace:       "ns1",
+			BalanceSRV:      "pool.example.com",
+			ResolveInterval: 50 * time.Millisecond,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil, syslog.WithResolver(resolver))
+
+		resolver.setSRV("pool.example.com", nil)
+		Eventually(resolver.srvLookups).Should(HaveLen(3))
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedWithBody("some-log\n")
+		Expect(activeAddrs(out)()).To(Equal([]string{spySink.url()}))
+	})
+})
+
+// spyResolver answers SRV lookups from records set by the test and host
+// lookups of IP addresses.
+type spyResolver struct {
+	mu      sync.Mutex
+	srvs    map[string][]*net.SRV
+	lookups []string
+	failing int
+}
+
+func newSpyResolver() *spyResolver {
+	return &spyResolver{
+		srvs: make(map[string][]*net.SRV),
+	}
+}
+
+func (r *spyResolver) setSRV(name string, srvs []*net.SRV) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.srvs[name] = srvs
+}
+
+// failSRV makes the next n SRV lookups fail.
+func (r *spyResolver) failSRV(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failing = n
+}
+
+func (r *spyResolver) srvLookups() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.lookups...)
+}
+
+func (r *spyResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) == nil {
+		return nil, errors.New("no such host")
+	}
+	return []string{host}, nil
+}
+
+func (r *spyResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	qname := "_" + service + "._" + proto + "." + name
+	r.lookups = append(r.lookups, qname)
+	srvs := r.srvs[name]
+	if r.failing > 0 {
+		r.failing--
+		return "", nil, errors.New("temporary failure")
+	}
+	if len(srvs) == 0 {
+		return "", nil, errors.New("no such host")
+	}
+	return qname, srvs, nil
+}
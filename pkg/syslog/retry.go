@@ -0,0 +1,144 @@
+package syslog
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRetryAttempts  = 5
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// RetryPolicy configures how failed writes are retried. Between attempts the
+// sink backs off exponentially with jitter, starting at InitialBackoff and
+// doubling up to MaxBackoff. While the sink is failing, every message waits
+// for the current backoff before the sink dials again.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a message is tried in total
+	// before it is dropped.
+	MaxAttempts int
+	// MaxAge is how long after the first attempt a message is retried.
+	// If neither MaxAttempts nor MaxAge is set, messages are tried up to
+	// five times.
+	MaxAge         time.Duration
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// BackoffState describes a sink that is backing off after failed writes.
+type BackoffState struct {
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	Delay               time.Duration `json:"delay"`
+	NextAttempt         time.Time     `json:"next_attempt"`
+}
+
+// backoff tracks the consecutive failures of a sink. It is only used from
+// the sink's goroutine; state is published for SinkState.
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+	rand    *rand.Rand
+
+	failures    int
+	delay       time.Duration
+	nextAttempt time.Time
+	state       atomic.Value
+}
+
+func newBackoff(p *RetryPolicy) *backoff {
+	if p == nil {
+		return nil
+	}
+	b := &backoff{
+		initial: p.InitialBackoff,
+		max:     p.MaxBackoff,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if b.initial <= 0 {
+		b.initial = defaultInitialBackoff
+	}
+	if b.max <= 0 {
+		b.max = defaultMaxBackoff
+	}
+	if b.max < b.initial {
+		b.max = b.initial
+	}
+	return b
+}
+
+// fail records a failure and schedules the next attempt. The delay doubles
+// with every consecutive failure and is jittered to between half and the
+// full delay so that many sinks do not retry in lockstep.
+func (b *backoff) fail(now time.Time) {
+	b.failures++
+	if b.delay == 0 {
+		b.delay = b.initial
+	} else {
+		b.delay *= 2
+		if b.delay > b.max {
+			b.delay = b.max
+		}
+	}
+
+	half := b.delay / 2
+	jittered := half + time.Duration(b.rand.Int63n(int64(half)+1))
+	b.nextAttempt = now.Add(jittered)
+	b.state.Store(&BackoffState{
+		ConsecutiveFailures: b.failures,
+		Delay:               jittered,
+		NextAttempt:         b.nextAttempt,
+	})
+}
+
+func (b *backoff) succeed() {
+	if b == nil || b.failures == 0 {
+		return
+	}
+	b.failures = 0
+	b.delay = 0
+	b.nextAttempt = time.Time{}
+	b.state.Store((*BackoffState)(nil))
+}
+
+// wait blocks until the next attempt is due.
+func (b *backoff) wait() {
+	if b == nil {
+		return
+	}
+	if d := time.Until(b.nextAttempt); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func (b *backoff) load() *BackoffState {
+	if b == nil {
+		return nil
+	}
+	state, _ := b.state.Load().(*BackoffState)
+	return state
+}
+
+func (s *Sink) shouldRetry(attempt int, age time.Duration) bool {
+	maxAttempts := s.retry.MaxAttempts
+	if maxAttempts <= 0 && s.retry.MaxAge <= 0 {
+		maxAttempts = defaultRetryAttempts
+	}
+	if maxAttempts > 0 && attempt >= maxAttempts {
+		return false
+	}
+	if s.retry.MaxAge > 0 && age+time.Until(s.backoff.nextAttempt) > s.retry.MaxAge {
+		return false
+	}
+	return true
+}
+
+// MessagesRetried returns the number of times a failed write was retried.
+func (s *Sink) MessagesRetried() int64 {
+	if s.pool != nil {
+		return s.pool.count(func(m *Sink) *int64 { return &m.messagesRetried })
+	}
+	return atomic.LoadInt64(&s.messagesRetried)
+}
@@ -0,0 +1,103 @@
+package syslog_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Retry", func() {
+	It("retries failed messages until the sink is reachable", func() {
+		addr := unusedAddr()
+		s := &syslog.Sink{
+			Addr:      addr,
+			Namespace: "ns1",
+			Retry: &syslog.RetryPolicy{
+				MaxAttempts:    100,
+				InitialBackoff: 20 * time.Millisecond,
+				MaxBackoff:     50 * time.Millisecond,
+			},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Eventually(func() *syslog.BackoffState {
+			return out.SinkState()[0].Backoff
+		}).ShouldNot(BeNil())
+		state := out.SinkState()[0].Backoff
+		Expect(state.ConsecutiveFailures).To(BeNumerically(">", 0))
+		Expect(state.NextAttempt).To(BeTemporally("~", time.Now(), time.Second))
+
+		spySink := newSpySink(addr)
+		defer spySink.stop()
+
+		spySink.expectReceived(
+			`<14>1 1970-01-01T00:00:00+00:00 - pod.log/ns1/pod-name/container-name - - [kubernetes@47450 namespace_name="ns1" object_name="pod-name" container_name="container-name"] some-log` + "\n",
+		)
+		Eventually(func() *syslog.BackoffState {
+			return out.SinkState()[0].Backoff
+		}).Should(BeNil())
+		Expect(s.MessagesDropped()).To(BeZero())
+		Expect(s.MessagesRetried()).To(BeNumerically(">", 0))
+	})
+
+	It("drops messages after the maximum number of attempts", func() {
+		s := &syslog.Sink{
+			Addr:      unusedAddr(),
+			Namespace: "ns1",
+			Retry: &syslog.RetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: 10 * time.Millisecond,
+			},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Eventually(s.MessagesDropped).Should(Equal(int64(1)))
+		Expect(s.MessagesRetried()).To(Equal(int64(2)))
+	})
+
+	It("drops messages that exceed the maximum age", func() {
+		s := &syslog.Sink{
+			Addr:      unusedAddr(),
+			Namespace: "ns1",
+			Retry: &syslog.RetryPolicy{
+				MaxAge:         200 * time.Millisecond,
+				InitialBackoff: 10 * time.Millisecond,
+				MaxBackoff:     20 * time.Millisecond,
+			},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Consistently(s.MessagesDropped, 150*time.Millisecond).Should(BeZero())
+		Eventually(s.MessagesDropped).Should(Equal(int64(1)))
+	})
+
+	It("throttles attempts across messages while the sink is failing", func() {
+		s := &syslog.Sink{
+			Addr:      unusedAddr(),
+			Namespace: "ns1",
+			Retry: &syslog.RetryPolicy{
+				MaxAttempts:    2,
+				InitialBackoff: 100 * time.Millisecond,
+			},
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		start := time.Now()
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Eventually(s.MessagesDropped, 3*time.Second).Should(Equal(int64(2)))
+		// The backoff delays of 100ms, 200ms and 400ms are jittered down
+		// to at least half.
+		Expect(time.Since(start)).To(BeNumerically(">=", 350*time.Millisecond))
+	})
+})
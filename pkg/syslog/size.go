@@ -0,0 +1,209 @@
+package syslog
+
+import (
+	"crypto/rand"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+// SizePolicy determines what a sink does with a message whose serialized
+// size exceeds the sink's MaxMessageSize.
+type SizePolicy string
+
+const (
+	// SizePolicyTruncate cuts the message body so that the message fits and
+	// marks it with truncatedMarker.
+	SizePolicyTruncate SizePolicy = "truncate"
+	// SizePolicySplit sends the message body as several numbered messages
+	// that share a correlation id in their structured data.
+	SizePolicySplit SizePolicy = "split"
+	// SizePolicyDrop drops the message and counts it as dropped.
+	SizePolicyDrop SizePolicy = "drop"
+)
+
+const (
+	truncatedMarker = "...[truncated]\n"
+	splitSDID       = "split@47450"
+)
+
+// ParseSizePolicy returns the SizePolicy for the given configuration value.
+// An empty value results in SizePolicyTruncate.
+func ParseSizePolicy(s string) (SizePolicy, error) {
+	switch p := SizePolicy(s); p {
+	case "":
+		return SizePolicyTruncate, nil
+	case SizePolicyTruncate, SizePolicySplit, SizePolicyDrop:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown message size policy %q", s)
+}
+
+// MessagesOversized returns the number of messages that exceeded the sink's
+// MaxMessageSize, regardless of how they were handled.
+func (s *Sink) MessagesOversized() int64 {
+	if s.pool != nil {
+		return s.pool.count(func(m *Sink) *int64 { return &m.messagesOversized })
+	}
+	return atomic.LoadInt64(&s.messagesOversized)
+}
+
+// enforceSize returns the messages that should be written for w so that
+// none of them exceed the sink's MaxMessageSize. Messages that are not
+// rfc5424 messages or can not be marshaled are passed through unchanged.
+func (s *Sink) enforceSize(w io.WriterTo) []io.WriterTo {
+	msg, ok := rfc5424Message(w)
+	if !ok || s.MaxMessageSize <= 0 {
+		return []io.WriterTo{w}
+	}
+
+	// Marshal w rather than msg so that an encoded message is serialized
+	// only once.
+	b, err := w.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil || len(b) <= s.MaxMessageSize {
+		return []io.WriterTo{w}
+	}
+	atomic.AddInt64(&s.messagesOversized, 1)
+
+	var msgs []io.WriterTo
+	switch s.SizePolicy {
+	case SizePolicySplit:
+		msgs = splitMessage(msg, s.MaxMessageSize)
+	case SizePolicyDrop:
+	default:
+		msgs = truncateMessage(msg, len(b), s.MaxMessageSize)
+	}
+
+	if len(msgs) == 0 {
+		atomic.AddInt64(&s.messagesDropped, 1)
+	}
+	return msgs
+}
+
+func truncateMessage(msg *rfc5424.Message, size, limit int) []io.WriterTo {
+	overhead := size - len(msg.Message)
+	avail := limit - overhead - len(truncatedMarker)
+	if avail <= 0 {
+		return nil
+	}
+
+	body := make([]byte, 0, avail+len(truncatedMarker))
+	body = append(body, msg.Message[:runeBoundary(msg.Message, avail)]...)
+	body = append(body, truncatedMarker...)
+
+	m := *msg
+	m.Message = body
+	return []io.WriterTo{&m}
+}
+
+func splitMessage(msg *rfc5424.Message, limit int) []io.WriterTo {
+	body := msg.Message
+	if len(body) > 0 && body[len(body)-1] == '\n' {
+		body = body[:len(body)-1]
+	}
+
+	// The part and total values are reserved at the widest size they could
+	// possibly take so that the overhead is an upper bound for every part.
+	id := correlationID()
+	width := strconv.Itoa(len(body))
+	overhead, err := messageOverhead(msg, splitData(id, width, width))
+	if err != nil {
+		return nil
+	}
+	// Each part is terminated by a newline.
+	avail := limit - overhead - 1
+	if avail <= 0 {
+		return nil
+	}
+
+	var parts [][]byte
+	for len(body) > 0 {
+		n := len(body)
+		if n > avail {
+			n = runeBoundary(body, avail)
+			if n == 0 {
+				n = avail
+			}
+		}
+		parts = append(parts, body[:n])
+		body = body[n:]
+	}
+
+	total := strconv.Itoa(len(parts))
+	msgs := make([]io.WriterTo, 0, len(parts))
+	for i, p := range parts {
+		m := *msg
+		m.Message = append(append(make([]byte, 0, len(p)+1), p...), '\n')
+		m.StructuredData = append(
+			append([]rfc5424.StructuredData(nil), msg.StructuredData...),
+			splitData(id, strconv.Itoa(i+1), total),
+		)
+		msgs = append(msgs, &m)
+	}
+	return msgs
+}
+
+func splitData(id, part, total string) rfc5424.StructuredData {
+	return rfc5424.StructuredData{
+		ID: splitSDID,
+		Parameters: []rfc5424.SDParam{
+			{
+				Name:  "id",
+				Value: id,
+			},
+			{
+				Name:  "part",
+				Value: part,
+			},
+			{
+				Name:  "total",
+				Value: total,
+			},
+		},
+	}
+}
+
+// messageOverhead returns the size of msg without its body once sd has been
+// added to its structured data.
+func messageOverhead(msg *rfc5424.Message, sd rfc5424.StructuredData) (int, error) {
+	m := *msg
+	m.Message = nil
+	m.StructuredData = append(
+		append([]rfc5424.StructuredData(nil), msg.StructuredData...),
+		sd,
+	)
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	// Account for the space separating the structured data from the body.
+	return len(b) + 1, nil
+}
+
+// runeBoundary returns the largest index <= n that does not split a UTF-8
+// encoded rune in b.
+func runeBoundary(b []byte, n int) int {
+	if n >= len(b) {
+		return len(b)
+	}
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	return n
+}
+
+func correlationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(atomic.AddInt64(&correlationSeq, 1), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+var correlationSeq int64
@@ -0,0 +1,152 @@
+package syslog_test
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("MaxMessageSize", func() {
+	const prefix = `<14>1 1970-01-01T00:00:00+00:00 - pod.log/ns1/pod-name/container-name - - [kubernetes@47450 namespace_name="ns1" object_name="pod-name" container_name="container-name"] `
+
+	It("sends messages within the limit unchanged", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:           spySink.url(),
+			Namespace:      "ns1",
+			MaxMessageSize: len(prefix) + 10,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceived(prefix + "some-log\n")
+		Expect(s.MessagesOversized()).To(BeZero())
+	})
+
+	It("truncates oversized messages with a marker by default", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:           spySink.url(),
+			Namespace:      "ns1",
+			MaxMessageSize: len(prefix) + 30,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(
+			record("0123456789abcdefghijklmnopqrstuvwxyz"),
+			time.Unix(0, 0).UTC(),
+			"pod.log",
+		)
+
+		spySink.expectReceived(prefix + "0123456789abcde...[truncated]\n")
+		Expect(s.MessagesOversized()).To(Equal(int64(1)))
+		Expect(s.MessagesDropped()).To(BeZero())
+	})
+
+	It("does not truncate in the middle of a multibyte character", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:           spySink.url(),
+			Namespace:      "ns1",
+			MaxMessageSize: len(prefix) + 19,
+			SizePolicy:     syslog.SizePolicyTruncate,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("abcü0123456789abcdef"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceived(prefix + "abc...[truncated]\n")
+	})
+
+	It("splits oversized messages into correlated parts", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:           spySink.url(),
+			Namespace:      "ns1",
+			MaxMessageSize: 250,
+			SizePolicy:     syslog.SizePolicySplit,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+		body := strings.Repeat("0123456789", 20)
+
+		out.Write(record(body), time.Unix(0, 0).UTC(), "pod.log")
+
+		conn := spySink.accept()
+		defer conn.Close()
+		buf := bufio.NewReader(conn)
+
+		var (
+			received string
+			ids      []string
+			total    string
+		)
+		for len(received) < len(body) {
+			var msg rfc5424.Message
+			_, err := msg.ReadFrom(buf)
+			Expect(err).ToNot(HaveOccurred())
+
+			b, err := msg.MarshalBinary()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(b)).To(BeNumerically("<=", 250))
+			Expect(msg.Message).To(HaveSuffix("\n"))
+
+			Expect(msg.StructuredData).To(HaveLen(2))
+			sd := msg.StructuredData[1]
+			Expect(sd.ID).To(Equal("split@47450"))
+			Expect(sd.Parameters).To(HaveLen(3))
+			ids = append(ids, sd.Parameters[0].Value)
+			Expect(sd.Parameters[1].Value).To(Equal(strconv.Itoa(len(ids))))
+			total = sd.Parameters[2].Value
+
+			received += strings.TrimSuffix(string(msg.Message), "\n")
+		}
+
+		Expect(received).To(Equal(body))
+		Expect(total).To(Equal(strconv.Itoa(len(ids))))
+		Expect(len(ids)).To(BeNumerically(">", 1))
+		for _, id := range ids {
+			Expect(id).To(Equal(ids[0]))
+		}
+		Expect(s.MessagesOversized()).To(Equal(int64(1)))
+	})
+
+	It("drops oversized messages and counts them", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:           spySink.url(),
+			Namespace:      "ns1",
+			MaxMessageSize: len(prefix) + 10,
+			SizePolicy:     syslog.SizePolicyDrop,
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record(strings.Repeat("x", 20)), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		spySink.expectReceivedOnly(prefix + "some-log\n")
+		Expect(s.MessagesOversized()).To(Equal(int64(1)))
+		Expect(s.MessagesDropped()).To(Equal(int64(1)))
+	})
+
+	It("parses size policies", func() {
+		for _, p := range []string{"", "truncate", "split", "drop"} {
+			_, err := syslog.ParseSizePolicy(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		_, err := syslog.ParseSizePolicy("shrink")
+		Expect(err).To(HaveOccurred())
+	})
+})
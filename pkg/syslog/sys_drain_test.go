@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
 	"time"
@@ -51,6 +52,34 @@ func newSpySink(addr ...string) *spySink {
 	}
 }
 
+// unusedAddr returns an address nothing is listening on.
+func unusedAddr() string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	addr := lis.Addr().String()
+	ExpectWithOffset(1, lis.Close()).To(Succeed())
+	return addr
+}
+
+// record returns a record of a log line of container-name in pod-name of
+// namespace ns1.
+func record(msg string) map[interface{}]interface{} {
+	return podRecord("ns1", "pod-name", msg)
+}
+
+// podRecord returns a record of a log line of container-name in the given
+// pod and namespace.
+func podRecord(namespace, pod, msg string) map[interface{}]interface{} {
+	return map[interface{}]interface{}{
+		"log": []byte(msg),
+		"kubernetes": map[interface{}]interface{}{
+			"namespace_name": []byte(namespace),
+			"pod_name":       []byte(pod),
+			"container_name": []byte("container-name"),
+		},
+	}
+}
+
 func (s *spySink) url() string {
 	return s.lis.Addr().String()
 }
@@ -121,6 +150,58 @@ func (s *spySink) expectReceived(msgs ...string) {
 	}
 }
 
+// expectReceivedOpen is like expectReceived but leaves the connection open
+// and returns it.
+func (s *spySink) expectReceivedOpen(msgs ...string) net.Conn {
+	conn := s.accept()
+	buf := bufio.NewReader(conn)
+
+	for _, expected := range msgs {
+		expected = fmt.Sprintf("%d %s", len(expected), expected)
+		actual, err := buf.ReadString('\n')
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, actual).To(Equal(expected))
+	}
+	return conn
+}
+
+// expectReceivedFrames reads octet counted frames instead of lines so that
+// messages containing newlines can be compared.
+func (s *spySink) expectReceivedFrames(msgs ...string) {
+	conn := s.accept()
+	defer func() {
+		_ = conn.Close()
+	}()
+	buf := bufio.NewReader(conn)
+
+	for _, expected := range msgs {
+		lenB, err := buf.ReadBytes(' ')
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		length, err := strconv.Atoi(string(lenB[:len(lenB)-1]))
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+
+		data := make([]byte, length)
+		_, err = io.ReadFull(buf, data)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, string(data)).To(Equal(expected))
+	}
+}
+
+func (s *spySink) expectReceivedWithBody(bodies ...string) {
+	conn := s.accept()
+	defer func() {
+		_ = conn.Close()
+	}()
+	buf := bufio.NewReader(conn)
+
+	for _, expected := range bodies {
+		var msg rfc5424.Message
+		_, err := msg.ReadFrom(buf)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, string(msg.Message)).To(Equal(expected))
+	}
+}
+
 func (s *spySink) expectReceivedOnly(msgs ...string) {
 	conn := s.accept()
 	defer func() {
@@ -0,0 +1,58 @@
+package syslog
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+const (
+	unixScheme     = "unix://"
+	unixgramScheme = "unixgram://"
+)
+
+// splitNetwork returns the network and address to dial for a sink address.
+// Addresses starting with unix:// or unixgram:// name the path of a unix
+// domain socket, all others a TCP host and port.
+func splitNetwork(addr string) (string, string) {
+	switch {
+	case strings.HasPrefix(addr, unixScheme):
+		return "unix", strings.TrimPrefix(addr, unixScheme)
+	case strings.HasPrefix(addr, unixgramScheme):
+		return "unixgram", strings.TrimPrefix(addr, unixgramScheme)
+	}
+	return "tcp", addr
+}
+
+// datagramConn is a connection to a datagram socket. Each message is
+// written as a single datagram without octet counting, as local syslog
+// daemons expect.
+type datagramConn struct {
+	net.Conn
+}
+
+// writeMessage writes w as a single datagram, or each message of a batch
+// as a datagram of its own.
+func (c *datagramConn) writeMessage(w io.WriterTo) error {
+	if b, ok := w.(*writeBatch); ok {
+		for _, m := range b.msgs {
+			err := c.writeMessage(m)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	m, ok := w.(encoding.BinaryMarshaler)
+	if !ok {
+		return fmt.Errorf("unsupported message type %T for datagram socket", w)
+	}
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = c.Write(b)
+	return err
+}
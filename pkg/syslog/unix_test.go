@@ -0,0 +1,126 @@
+package syslog_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Unix domain socket sinks", func() {
+	var dir string
+
+	readDatagram := func(conn net.PacketConn) string {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 65536)
+		n, _, err := conn.ReadFrom(buf)
+		Expect(err).ToNot(HaveOccurred())
+		var msg rfc5424.Message
+		Expect(msg.UnmarshalBinary(buf[:n])).To(Succeed())
+		return string(msg.Message)
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "out-syslog")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("writes octet counted messages to stream sockets", func() {
+		path := filepath.Join(dir, "syslog.sock")
+		lis, err := net.Listen("unix", path)
+		Expect(err).ToNot(HaveOccurred())
+		defer lis.Close()
+		s := &syslog.Sink{
+			Addr:      "unix://" + path,
+			Namespace: "ns1",
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+
+		conn, err := lis.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := bufio.NewReader(conn)
+		for _, want := range []string{"first\n", "second\n"} {
+			var msg rfc5424.Message
+			_, err = msg.ReadFrom(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(msg.Message)).To(Equal(want))
+		}
+		Expect(out.SinkState()[0].ActiveAddr).To(Equal("unix://" + path))
+	})
+
+	It("writes each message as a datagram to datagram sockets", func() {
+		path := filepath.Join(dir, "log")
+		conn, err := net.ListenPacket("unixgram", path)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		s := &syslog.Sink{
+			Addr:      "unixgram://" + path,
+			Namespace: "ns1",
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Expect(readDatagram(conn)).To(Equal("first\n"))
+		Expect(readDatagram(conn)).To(Equal("second\n"))
+		Eventually(func() *syslog.SinkError {
+			return out.SinkState()[0].Error
+		}).Should(BeNil())
+	})
+
+	It("reconnects once a datagram socket is recreated", func() {
+		path := filepath.Join(dir, "log")
+		conn, err := net.ListenPacket("unixgram", path)
+		Expect(err).ToNot(HaveOccurred())
+		s := &syslog.Sink{
+			Addr:      "unixgram://" + path,
+			Namespace: "ns1",
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("first"), time.Unix(0, 0).UTC(), "pod.log")
+		Expect(readDatagram(conn)).To(Equal("first\n"))
+
+		Expect(conn.Close()).To(Succeed())
+		Expect(os.Remove(path)).To(Succeed())
+		conn, err = net.ListenPacket("unixgram", path)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		out.Write(record("second"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Expect(readDatagram(conn)).To(Equal("second\n"))
+		Expect(s.MessagesDropped()).To(BeZero())
+	})
+
+	It("reports an error when the socket does not exist", func() {
+		s := &syslog.Sink{
+			Addr:      "unix://" + filepath.Join(dir, "missing.sock"),
+			Namespace: "ns1",
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil)
+
+		out.Write(record("some-log"), time.Unix(0, 0).UTC(), "pod.log")
+
+		Eventually(s.MessagesDropped).Should(Equal(int64(1)))
+		Expect(out.SinkState()[0].Error.Msg).To(ContainSubstring("missing.sock"))
+	})
+})
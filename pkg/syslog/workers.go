@@ -0,0 +1,103 @@
+package syslog
+
+import (
+	"sync"
+	"time"
+)
+
+const conversionQueueSize = 256
+
+// WithConversionWorkers makes Write hand records to n goroutines that
+// convert and route them concurrently. Records of the same pod are always
+// converted by the same goroutine, so they reach every sink in the order
+// they were written. n less than two converts records on the calling
+// goroutine.
+func WithConversionWorkers(n int) OutOption {
+	return func(o *Out) {
+		o.conversionWorkers = n
+	}
+}
+
+type conversion struct {
+	record map[interface{}]interface{}
+	ts     time.Time
+	tag    string
+}
+
+// converters is a pool of goroutines converting records.
+type converters struct {
+	queues []chan conversion
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending int
+}
+
+func (o *Out) startConverters(n int) *converters {
+	c := &converters{
+		queues: make([]chan conversion, n),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	for i := range c.queues {
+		q := make(chan conversion, conversionQueueSize)
+		c.queues[i] = q
+		go func() {
+			for cv := range q {
+				o.write(cv.record, cv.ts, cv.tag)
+				c.done()
+			}
+		}()
+	}
+	return c
+}
+
+// dispatch queues the record for the goroutine responsible for its pod.
+func (c *converters) dispatch(record map[interface{}]interface{}, ts time.Time, tag string) {
+	c.mu.Lock()
+	c.pending++
+	c.mu.Unlock()
+
+	q := c.queues[podShard(record)%uint32(len(c.queues))]
+	q <- conversion{record: record, ts: ts, tag: tag}
+}
+
+func (c *converters) done() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending--
+	if c.pending == 0 {
+		c.cond.Broadcast()
+	}
+}
+
+// wait blocks until all dispatched records have been converted.
+func (c *converters) wait() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.pending > 0 {
+		c.cond.Wait()
+	}
+}
+
+// podShard hashes the namespace and pod name of a record with FNV-1a
+// without converting them to strings. Records without kubernetes metadata
+// share a shard.
+func podShard(record map[interface{}]interface{}) uint32 {
+	k8sMap, _ := record["kubernetes"].(map[interface{}]interface{})
+	ns, _ := k8sMap["namespace_name"].([]byte)
+	pod, _ := k8sMap["pod_name"].([]byte)
+
+	const prime = 16777619
+	h := uint32(2166136261)
+	for _, b := range ns {
+		h = (h ^ uint32(b)) * prime
+	}
+	h = (h ^ '/') * prime
+	for _, b := range pod {
+		h = (h ^ uint32(b)) * prime
+	}
+	return mix32(h)
+}
@@ -0,0 +1,76 @@
+package syslog_test
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/fluent-bit-out-syslog/pkg/syslog"
+)
+
+var _ = Describe("Conversion workers", func() {
+	numbered := func(pod string, i int) map[interface{}]interface{} {
+		return podRecord("ns1", pod, fmt.Sprintf("%s %d", pod, i))
+	}
+
+	It("keeps the records of each pod in order", func() {
+		spySink := newSpySink()
+		defer spySink.stop()
+		s := &syslog.Sink{
+			Addr:      spySink.url(),
+			Namespace: "ns1",
+		}
+		out := syslog.NewOut([]*syslog.Sink{s}, nil, syslog.WithConversionWorkers(4))
+
+		pods := []string{"pod-a", "pod-b", "pod-c", "pod-d", "pod-e"}
+		const perPod = 100
+		for i := 0; i < perPod; i++ {
+			for _, pod := range pods {
+				out.Write(numbered(pod, i), time.Unix(0, 0).UTC(), "pod.log")
+			}
+		}
+		out.Wait()
+
+		conn := spySink.accept()
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := bufio.NewReader(conn)
+		next := make(map[string]int)
+		for i := 0; i < perPod*len(pods); i++ {
+			var msg rfc5424.Message
+			_, err := msg.ReadFrom(buf)
+			Expect(err).ToNot(HaveOccurred())
+
+			var (
+				pod string
+				n   int
+			)
+			_, err = fmt.Sscanf(strings.TrimSpace(string(msg.Message)), "%s %d", &pod, &n)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(next[pod]), "record of %s out of order", pod)
+			next[pod]++
+		}
+		for _, pod := range pods {
+			Expect(next[pod]).To(Equal(perPod))
+		}
+		Expect(s.MessagesDropped()).To(BeZero())
+	})
+
+	It("returns from Wait right away without workers", func() {
+		out := syslog.NewOut(nil, nil)
+
+		out.Write(numbered("pod-a", 0), time.Unix(0, 0).UTC(), "pod.log")
+
+		done := make(chan struct{})
+		go func() {
+			out.Wait()
+			close(done)
+		}()
+		Eventually(done).Should(BeClosed())
+	})
+})